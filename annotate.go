@@ -0,0 +1,65 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"strings"
+	"time"
+
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/kubernetes"
+
+	log "github.com/sirupsen/logrus"
+)
+
+const expiresAtAnnotation = "verify-k8s-certs/expires-at"
+
+// serviceAnnotator writes the soonest certificate expiry of every service as an annotation on it.
+// A service is patched only when the value changes, and at most once per minInterval.
+type serviceAnnotator struct {
+	clientset   *kubernetes.Clientset
+	minInterval time.Duration
+	lastPatch   map[string]time.Time
+}
+
+func newServiceAnnotator(clientset *kubernetes.Clientset, minInterval time.Duration) *serviceAnnotator {
+	return &serviceAnnotator{clientset: clientset, minInterval: minInterval, lastPatch: make(map[string]time.Time)}
+}
+
+// annotate patches the services whose soonest expiry differs from their current annotation.
+// soonest and current are indexed by namespace/name.
+func (a *serviceAnnotator) annotate(soonest map[string]time.Time, current map[string]string) {
+	now := time.Now()
+
+	for key, expiry := range soonest {
+		value := expiry.UTC().Format(time.RFC3339)
+		if current[key] == value {
+			continue
+		}
+		if last, found := a.lastPatch[key]; found && now.Sub(last) < a.minInterval {
+			continue
+		}
+
+		parts := strings.SplitN(key, "/", 2)
+		patch, _ := json.Marshal(map[string]interface{}{
+			"metadata": map[string]interface{}{
+				"annotations": map[string]string{expiresAtAnnotation: value},
+			},
+		})
+
+		_, err := a.clientset.CoreV1().Services(parts[0]).Patch(context.TODO(), parts[1], types.MergePatchType, patch, metav1.PatchOptions{})
+		if apierrors.IsForbidden(err) {
+			log.Errorf("Not allowed to patch the services, grant the patch verb on services to the serviceaccount or disable -annotate-services: %v", err)
+			return
+		}
+		if err != nil {
+			log.Errorf("Could not annotate service %s: %v", key, err)
+			continue
+		}
+
+		a.lastPatch[key] = now
+		log.Debugf("Annotated service %s with %s=%s", key, expiresAtAnnotation, value)
+	}
+}
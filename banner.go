@@ -0,0 +1,38 @@
+package main
+
+import (
+	"net"
+	"strings"
+	"time"
+)
+
+/* upper bound of -read-banner */
+const maxBannerBytes = 4096
+
+// readBanner reads what the server sends right after the handshake, up to n bytes, e.g. the greeting of SMTP or FTP.
+// Servers that wait for the client to speak first send nothing, so the read ends at the timeout
+func readBanner(conn net.Conn, n int, timeout time.Duration) (string, error) {
+	if err := conn.SetReadDeadline(time.Now().Add(timeout)); err != nil {
+		return "", err
+	}
+	defer conn.SetReadDeadline(time.Time{})
+
+	buf := make([]byte, n)
+	read, err := conn.Read(buf)
+	if read == 0 {
+		return "", err
+	}
+	return sanitizeBanner(buf[:read]), nil
+}
+
+// sanitizeBanner keeps the printable ASCII characters of the banner, replacing the others with a dot
+func sanitizeBanner(data []byte) string {
+	banner := make([]byte, len(data))
+	for i, c := range data {
+		if c < 0x20 || c > 0x7e {
+			c = '.'
+		}
+		banner[i] = c
+	}
+	return strings.TrimRight(string(banner), ".")
+}
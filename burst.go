@@ -0,0 +1,44 @@
+package main
+
+import "sync"
+
+/* upper bound of -burst-handshakes, the burst must not look like an attack to the service */
+const maxBurstHandshakes = 10
+
+// probeBurst opens n simultaneous handshakes to the address of the result, presenting the same server name,
+// and reports whether all the ones that succeeded presented the leaf certificate of the result.
+// This catches the workers of a single endpoint serving different certificates. compared is false
+// when none of the handshakes succeeded, the burst then tells nothing about the consistency
+func probeBurst(opts probeOptions, result ProbeResult, serverName string, n int) (consistent bool, compared bool) {
+	/* only the presented certificates matter, waiting for a banner would hold every handshake for the whole timeout */
+	opts.verifyChain = false
+	opts.estimateClockSkew = false
+	opts.bannerBytes = 0
+
+	burst := make([]ProbeResult, n)
+	var wg sync.WaitGroup
+	for i := 0; i < n; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			probe := ProbeResult{
+				Namespace: result.Namespace,
+				Service:   result.Service,
+				Port:      result.Port,
+				Address:   result.Address,
+			}
+			burst[i] = probeAddress(opts, probe, serverName)
+		}(i)
+	}
+	wg.Wait()
+
+	expected := fingerprint(result.Leaf())
+	consistent = true
+	for _, probe := range burst {
+		if leaf := probe.Leaf(); leaf != nil {
+			compared = true
+			consistent = consistent && fingerprint(leaf) == expected
+		}
+	}
+	return consistent, compared
+}
@@ -0,0 +1,47 @@
+package main
+
+import (
+	"io/ioutil"
+	stdlog "log"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestProbeBurstSkipsTheBanner(t *testing.T) {
+	/* an HTTPS server waits for the client to speak first, it never sends a banner */
+	server := httptest.NewTLSServer(http.NotFoundHandler())
+	server.Config.ErrorLog = stdlog.New(ioutil.Discard, "", 0)
+	defer server.Close()
+
+	opts := probeOptions{timeout: time.Second, bannerBytes: 64}
+	result := probeAddress(opts, ProbeResult{Address: server.Listener.Addr().String()}, "localhost")
+	if !result.Success {
+		t.Fatalf("probe failed: %v", result.Error)
+	}
+
+	start := time.Now()
+	consistent, compared := probeBurst(opts, result, "localhost", maxBurstHandshakes)
+	if elapsed := time.Since(start); elapsed >= opts.timeout {
+		t.Errorf("the burst took %v, it waited for a banner", elapsed)
+	}
+	if !compared || !consistent {
+		t.Errorf("probeBurst() = %v, %v, expected a consistent burst", consistent, compared)
+	}
+}
+
+func TestProbeBurstAllHandshakesFailed(t *testing.T) {
+	server := httptest.NewTLSServer(http.NotFoundHandler())
+	server.Config.ErrorLog = stdlog.New(ioutil.Discard, "", 0)
+
+	result := probeTestAddress(server.Listener.Addr().String())
+	if !result.Success {
+		t.Fatalf("probe failed: %v", result.Error)
+	}
+	server.Close()
+
+	if _, compared := probeBurst(probeOptions{timeout: time.Second}, result, "localhost", 3); compared {
+		t.Error("a burst whose handshakes all failed was compared")
+	}
+}
@@ -0,0 +1,101 @@
+package main
+
+import (
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+var (
+	probeCacheEntriesGauge = promauto.NewGauge(prometheus.GaugeOpts{
+		Name: "tls_verifier_probe_cache_entries",
+		Help: "How many targets have their probe results cached",
+	})
+	probeCacheHitsCounter = promauto.NewCounter(prometheus.CounterOpts{
+		Name: "tls_verifier_probe_cache_hits_total",
+		Help: "How many probes were answered from the cache",
+	})
+	probeCacheMissesCounter = promauto.NewCounter(prometheus.CounterOpts{
+		Name: "tls_verifier_probe_cache_misses_total",
+		Help: "How many probes were not found in the cache and hit the network",
+	})
+)
+
+type cachedProbe struct {
+	results   []ProbeResult
+	expiresAt time.Time
+}
+
+// probeCache keeps the results of the successful probes of each target for a short TTL,
+// so that a scan right after another one does not probe the same targets again
+type probeCache struct {
+	sync.Mutex
+	ttl     time.Duration
+	entries map[string]cachedProbe
+}
+
+func newProbeCache(ttl time.Duration) *probeCache {
+	return &probeCache{ttl: ttl, entries: make(map[string]cachedProbe)}
+}
+
+// probe returns the cached results of the target, probing it when they are missing or expired
+func (c *probeCache) probe(opts probeOptions, target scanTarget) []ProbeResult {
+	if c.ttl <= 0 {
+		return probeTarget(opts, target)
+	}
+
+	key := target.key()
+	now := time.Now()
+
+	c.Lock()
+	entry, found := c.entries[key]
+	c.Unlock()
+
+	if found && now.Before(entry.expiresAt) {
+		probeCacheHitsCounter.Inc()
+		return entry.results
+	}
+	probeCacheMissesCounter.Inc()
+
+	results := probeTarget(opts, target)
+
+	c.Lock()
+	defer c.Unlock()
+
+	if expiresAt, cacheable := c.expiry(results, now); cacheable {
+		c.entries[key] = cachedProbe{results: results, expiresAt: expiresAt}
+	} else {
+		delete(c.entries, key)
+	}
+	c.purge(now)
+	probeCacheEntriesGauge.Set(float64(len(c.entries)))
+
+	return results
+}
+
+// expiry tells until when the results can be cached: failures are never cached, and no entry
+// outlives the certificates it holds so that an expiring certificate is probed again right away
+func (c *probeCache) expiry(results []ProbeResult, now time.Time) (time.Time, bool) {
+	expiresAt := now.Add(c.ttl)
+	for _, result := range results {
+		if !result.Success {
+			return time.Time{}, false
+		}
+		for _, cert := range result.Certs {
+			if cert.NotAfter.Before(expiresAt) {
+				expiresAt = cert.NotAfter
+			}
+		}
+	}
+	return expiresAt, len(results) > 0 && now.Before(expiresAt)
+}
+
+func (c *probeCache) purge(now time.Time) {
+	for key, entry := range c.entries {
+		if !now.Before(entry.expiresAt) {
+			delete(c.entries, key)
+		}
+	}
+}
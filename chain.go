@@ -0,0 +1,229 @@
+package main
+
+import (
+	"bytes"
+	"crypto/x509"
+	"fmt"
+	"io/ioutil"
+	"strings"
+	"time"
+
+	"k8s.io/apimachinery/pkg/labels"
+)
+
+// loadCABundle reads a PEM file with the roots trusted for chain verification
+func loadCABundle(path string) (*x509.CertPool, error) {
+	pem, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(pem) {
+		return nil, fmt.Errorf("no certificates found in %s", path)
+	}
+	return pool, nil
+}
+
+// verifyChain checks that the leaf chains up to one of the roots (system roots when nil)
+// using the other presented certificates as intermediates. The host name is not checked.
+func verifyChain(certs []*x509.Certificate, roots *x509.CertPool) ([][]*x509.Certificate, error) {
+	if len(certs) == 0 {
+		return nil, fmt.Errorf("no certificates presented")
+	}
+
+	leaf := leafIndex(certs)
+	intermediates := x509.NewCertPool()
+	for i, cert := range certs {
+		if i != leaf {
+			intermediates.AddCert(cert)
+		}
+	}
+
+	return certs[leaf].Verify(x509.VerifyOptions{
+		Roots:         roots,
+		Intermediates: intermediates,
+		KeyUsages:     []x509.ExtKeyUsage{x509.ExtKeyUsageAny},
+	})
+}
+
+// effectiveExpiry is when the chain stops being valid: the soonest expiry among its certificates
+func effectiveExpiry(certs []*x509.Certificate) time.Time {
+	var expiry time.Time
+	for i, cert := range certs {
+		if i == 0 || cert.NotAfter.Before(expiry) {
+			expiry = cert.NotAfter
+		}
+	}
+	return expiry
+}
+
+// chainTracker smooths the chain validity of each target: a chain is reported invalid only
+// after `window` consecutive invalid probes, while a single valid probe reports it valid again.
+// This avoids flapping during rollouts, when not every pod serves the intermediates yet.
+type chainTracker struct {
+	window   int
+	failures map[string]int
+}
+
+func newChainTracker(window int) *chainTracker {
+	return &chainTracker{window: window, failures: make(map[string]int)}
+}
+
+// observe records the validity found by the latest probe of the target and returns the one to report
+func (c *chainTracker) observe(key string, valid bool) bool {
+	if valid {
+		delete(c.failures, key)
+		return true
+	}
+
+	c.failures[key]++
+	return c.failures[key] < c.window
+}
+
+func boolToFloat(b bool) float64 {
+	if b {
+		return 1
+	}
+	return 0
+}
+
+type namespaceRoots struct {
+	namespaces map[string]bool
+	selector   labels.Selector /* nil when matching by name only */
+	roots      *x509.CertPool
+}
+
+// trustStore picks the roots used to verify the chains of a namespace: the first
+// matching entry of the configuration file, then the -ca-bundle roots, then the system roots
+type trustStore struct {
+	entries []namespaceRoots
+	roots   *x509.CertPool /* nil means the system roots */
+}
+
+func newTrustStore(config *Config, roots *x509.CertPool) (*trustStore, error) {
+	store := &trustStore{roots: roots}
+
+	for _, b := range config.NamespaceCABundles {
+		pool, err := loadCABundle(b.CABundle)
+		if err != nil {
+			return nil, err
+		}
+
+		entry := namespaceRoots{namespaces: make(map[string]bool), roots: pool}
+		for _, ns := range b.Namespaces {
+			entry.namespaces[ns] = true
+		}
+		if b.NamespaceSelector != "" {
+			if entry.selector, err = labels.Parse(b.NamespaceSelector); err != nil {
+				return nil, err
+			}
+		}
+		store.entries = append(store.entries, entry)
+	}
+
+	return store, nil
+}
+
+// hasSelectors reports whether the labels of the namespaces are needed to pick the roots
+func (t *trustStore) hasSelectors() bool {
+	for _, entry := range t.entries {
+		if entry.selector != nil {
+			return true
+		}
+	}
+	return false
+}
+
+// rootsFor returns the roots to verify the chains of the namespace with the given labels
+func (t *trustStore) rootsFor(namespace string, namespaceLabels map[string]string) *x509.CertPool {
+	for _, entry := range t.entries {
+		if entry.namespaces[namespace] || (entry.selector != nil && entry.selector.Matches(labels.Set(namespaceLabels))) {
+			return entry.roots
+		}
+	}
+	return t.roots
+}
+
+// issuerPath returns the positions of the presented certificates on the issuer path of the leaf picked by leafIndex,
+// from the leaf up, whatever the presented order: every certificate is followed by the one that issued and signed it.
+// The basic constraints of the issuers are not checked, so that a misconfigured one still belongs to the path.
+// The certificates not on that path, e.g. an unrelated one presented by mistake, are left out
+func issuerPath(certs []*x509.Certificate) []int {
+	path := []int{leafIndex(certs)}
+	used := map[int]bool{path[0]: true}
+
+	for linked := true; linked; {
+		linked = false
+		current := certs[path[len(path)-1]]
+		for i, cert := range certs {
+			if !used[i] && issued(cert, current) {
+				path = append(path, i)
+				used[i] = true
+				linked = true
+				break
+			}
+		}
+	}
+	return path
+}
+
+// issued tells whether issuer issued cert: its subject is the issuer of cert and its key signed cert
+func issued(issuer, cert *x509.Certificate) bool {
+	return bytes.Equal(cert.RawIssuer, issuer.RawSubject) &&
+		issuer.CheckSignature(cert.SignatureAlgorithm, cert.RawTBSCertificate, cert.Signature) == nil
+}
+
+// constraintAnomalies describes the basic constraints misconfigurations of a chain: a leaf marked as CA,
+// an intermediate not marked as CA, or an intermediate whose path length constraint does not allow the
+// intermediates below it. Only the certificates on the issuer path of the leaf are judged, walked from the leaf up
+// as ordered by issuerPath, the positions in the descriptions are the presented ones
+func constraintAnomalies(certs []*x509.Certificate) []string {
+	if len(certs) == 0 {
+		return nil
+	}
+
+	var anomalies []string
+
+	path := issuerPath(certs)
+	if cert := certs[path[0]]; cert.BasicConstraintsValid && cert.IsCA {
+		anomalies = append(anomalies, fmt.Sprintf("leaf %q is marked as CA", cert.Subject.CommonName))
+	}
+
+	for n, i := range path[1:] {
+		cert := certs[i]
+		/* the intermediates between this one and the leaf */
+		below := n
+
+		if !cert.BasicConstraintsValid || !cert.IsCA {
+			anomalies = append(anomalies, fmt.Sprintf("intermediate %q at position %d is not marked as CA", cert.Subject.CommonName, i))
+			continue
+		}
+
+		if pathLenSet := cert.MaxPathLen > 0 || cert.MaxPathLenZero; pathLenSet && cert.MaxPathLen < below {
+			anomalies = append(anomalies, fmt.Sprintf("intermediate %q at position %d allows a path length of %d but %d intermediates follow it",
+				cert.Subject.CommonName, i, cert.MaxPathLen, below))
+		}
+	}
+
+	return anomalies
+}
+
+// chainOrderValid tells whether the chain is presented in order: every certificate is issued, and signed, by the next one
+func chainOrderValid(certs []*x509.Certificate) bool {
+	for i := 0; i+1 < len(certs); i++ {
+		if !bytes.Equal(certs[i].RawIssuer, certs[i+1].RawSubject) || certs[i].CheckSignatureFrom(certs[i+1]) != nil {
+			return false
+		}
+	}
+	return true
+}
+
+// chainOrder describes the presented chain, subjects and issuers in the order they were presented
+func chainOrder(certs []*x509.Certificate) string {
+	order := make([]string, 0, len(certs))
+	for i, cert := range certs {
+		order = append(order, fmt.Sprintf("[%d] %q issued by %q", i, cert.Subject.CommonName, cert.Issuer.CommonName))
+	}
+	return strings.Join(order, ", ")
+}
@@ -0,0 +1,137 @@
+package main
+
+import (
+	"crypto/x509"
+	"testing"
+)
+
+func TestReorderedChain(t *testing.T) {
+	c := newTestChain(t)
+	roots := x509.NewCertPool()
+	roots.AddCert(c.root)
+
+	tests := []struct {
+		name  string
+		certs []*x509.Certificate
+	}{
+		{"leaf first", []*x509.Certificate{c.leaf, c.intermediate}},
+		{"intermediate first", []*x509.Certificate{c.intermediate, c.leaf}},
+		{"root and intermediate first", []*x509.Certificate{c.root, c.intermediate, c.leaf}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if leaf := tt.certs[leafIndex(tt.certs)]; leaf != c.leaf {
+				t.Errorf("leafIndex picked %q, expected the leaf", leaf.Subject.CommonName)
+			}
+			if anomalies := constraintAnomalies(tt.certs); len(anomalies) > 0 {
+				t.Errorf("constraintAnomalies() = %v, expected none", anomalies)
+			}
+			if _, err := verifyChain(tt.certs, roots); err != nil {
+				t.Errorf("verifyChain() failed: %v", err)
+			}
+		})
+	}
+}
+
+func TestReorderedChainLeafAtIndexZero(t *testing.T) {
+	c := newTestChain(t)
+
+	leafAtIndexZero = true
+	defer func() { leafAtIndexZero = false }()
+
+	certs := []*x509.Certificate{c.intermediate, c.leaf}
+	if leafIndex(certs) != 0 {
+		t.Fatalf("leafIndex() = %d with -leaf-at-index-zero, expected 0", leafIndex(certs))
+	}
+	/* taken literally, the leaf is marked as CA, and the real leaf is not on its issuer path so it is not judged */
+	if anomalies := constraintAnomalies(certs); len(anomalies) != 1 {
+		t.Fatalf("constraintAnomalies() = %v, expected 1 anomaly", anomalies)
+	}
+}
+
+func TestConstraintAnomalies(t *testing.T) {
+	rootKey, interKey, subKey, leafKey := newTestKey(t), newTestKey(t), newTestKey(t), newTestKey(t)
+	root := issueTestCert(t, caTemplate("root"), rootKey, nil, nil)
+
+	/* an intermediate allowing no intermediate below it */
+	pathLenZeroTemplate := caTemplate("path-len-zero")
+	pathLenZeroTemplate.MaxPathLen, pathLenZeroTemplate.MaxPathLenZero = 0, true
+	pathLenZero := issueTestCert(t, pathLenZeroTemplate, interKey, root, rootKey)
+
+	/* an intermediate allowing one intermediate below it */
+	pathLenOneTemplate := caTemplate("path-len-one")
+	pathLenOneTemplate.MaxPathLen = 1
+	pathLenOne := issueTestCert(t, pathLenOneTemplate, interKey, root, rootKey)
+
+	/* every leaf is issued by the intermediate under test, directly or through a sub intermediate */
+	subOfPathLenOne := issueTestCert(t, caTemplate("sub-of-path-len-one"), subKey, pathLenOne, interKey)
+	leafOfPathLenOne := issueTestCert(t, leafTemplate("leaf-of-path-len-one"), leafKey, subOfPathLenOne, subKey)
+	subOfPathLenZero := issueTestCert(t, caTemplate("sub-of-path-len-zero"), subKey, pathLenZero, interKey)
+	leafOfPathLenZero := issueTestCert(t, leafTemplate("leaf-of-path-len-zero"), leafKey, subOfPathLenZero, subKey)
+
+	/* a leaf marked as CA cannot be told apart by leafIndex, it is taken as leaf being presented first */
+	caLeafOfPathLenOne := issueTestCert(t, caTemplate("ca-leaf-of-path-len-one"), leafKey, pathLenOne, interKey)
+	caLeafOfPathLenZero := issueTestCert(t, caTemplate("ca-leaf-of-path-len-zero"), leafKey, pathLenZero, interKey)
+
+	notCA := issueTestCert(t, leafTemplate("not-a-ca"), subKey, root, rootKey)
+	leafOfNotCA := issueTestCert(t, leafTemplate("leaf-of-not-a-ca"), leafKey, notCA, subKey)
+
+	tests := []struct {
+		name      string
+		certs     []*x509.Certificate
+		anomalies []string
+	}{
+		{"valid chain", []*x509.Certificate{leafOfPathLenOne, subOfPathLenOne, pathLenOne}, nil},
+		{"leaf marked as CA", []*x509.Certificate{caLeafOfPathLenOne, pathLenOne, root}, []string{`leaf "ca-leaf-of-path-len-one" is marked as CA`}},
+		{"intermediate not marked as CA", []*x509.Certificate{leafOfNotCA, notCA}, []string{`intermediate "not-a-ca" at position 1 is not marked as CA`}},
+		{"path length exceeded", []*x509.Certificate{leafOfPathLenZero, subOfPathLenZero, pathLenZero}, []string{`intermediate "path-len-zero" at position 2 allows a path length of 0 but 1 intermediates follow it`}},
+		{"path length exceeded, reordered", []*x509.Certificate{pathLenZero, subOfPathLenZero, leafOfPathLenZero}, []string{`intermediate "path-len-zero" at position 0 allows a path length of 0 but 1 intermediates follow it`}},
+		{"path length zero right above the leaf", []*x509.Certificate{caLeafOfPathLenZero, pathLenZero}, []string{`leaf "ca-leaf-of-path-len-zero" is marked as CA`}},
+		/* the certificates that did not issue the leaf are not judged, whatever their constraints */
+		{"unrelated certificate not marked as CA", []*x509.Certificate{leafOfPathLenOne, subOfPathLenOne, pathLenOne, notCA}, nil},
+		{"unrelated intermediate with a path length exceeded", []*x509.Certificate{leafOfPathLenOne, subOfPathLenZero, pathLenZero}, nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			anomalies := constraintAnomalies(tt.certs)
+			if len(anomalies) != len(tt.anomalies) {
+				t.Fatalf("constraintAnomalies() = %q, expected %q", anomalies, tt.anomalies)
+			}
+			for i := range anomalies {
+				if anomalies[i] != tt.anomalies[i] {
+					t.Errorf("constraintAnomalies()[%d] = %q, expected %q", i, anomalies[i], tt.anomalies[i])
+				}
+			}
+		})
+	}
+}
+
+func TestChainOrderValid(t *testing.T) {
+	c := newTestChain(t)
+	/* same subject as the intermediate, but another key: the name matches, the signature does not */
+	impostor := issueTestCert(t, caTemplate("intermediate"), newTestKey(t), c.root, c.rootKey)
+
+	tests := []struct {
+		name  string
+		certs []*x509.Certificate
+		valid bool
+	}{
+		{"leaf only", []*x509.Certificate{c.leaf}, true},
+		{"ordered, root omitted", []*x509.Certificate{c.leaf, c.intermediate}, true},
+		{"ordered, root included", []*x509.Certificate{c.leaf, c.intermediate, c.root}, true},
+		{"intermediate first", []*x509.Certificate{c.intermediate, c.leaf}, false},
+		{"root before the intermediate", []*x509.Certificate{c.leaf, c.root, c.intermediate}, false},
+		{"intermediate missing", []*x509.Certificate{c.leaf, c.root}, false},
+		{"intermediate with another key", []*x509.Certificate{c.leaf, impostor}, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if valid := chainOrderValid(tt.certs); valid != tt.valid {
+				t.Errorf("chainOrderValid() = %v, expected %v for %s", valid, tt.valid, chainOrder(tt.certs))
+			}
+		})
+	}
+}
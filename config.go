@@ -0,0 +1,161 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"io/ioutil"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"k8s.io/apimachinery/pkg/labels"
+	"sigs.k8s.io/yaml"
+)
+
+// Config is the content of the optional configuration file passed with -config
+type Config struct {
+	// NamespaceCABundles maps namespaces to the roots used to verify their chains,
+	// the first matching entry wins
+	NamespaceCABundles []NamespaceCABundle `json:"namespaceCABundles,omitempty"`
+	// RequiredPolicies lists the certificate policy OIDs the leaf certificates must carry,
+	// every matching entry applies
+	RequiredPolicies []RequiredPolicy `json:"requiredPolicies,omitempty"`
+}
+
+// NamespaceCABundle trusts the roots of a PEM file for the namespaces listed by name or matching the selector
+type NamespaceCABundle struct {
+	Namespaces        []string `json:"namespaces,omitempty"`
+	NamespaceSelector string   `json:"namespaceSelector,omitempty"` /* label selector on the namespaces */
+	CABundle          string   `json:"caBundle"`
+}
+
+// RequiredPolicy requires a certificate policy OID in the leaf certificates of the services listed by name,
+// or of all the services when none is listed, of the namespaces listed by name, or of all the namespaces when none is listed
+type RequiredPolicy struct {
+	Namespaces []string `json:"namespaces,omitempty"`
+	Services   []string `json:"services,omitempty"`
+	PolicyOID  string   `json:"policyOID"`
+}
+
+var oidRegex = regexp.MustCompile(`^[0-2](\.(0|[1-9][0-9]*))+$`)
+
+func loadConfig(path string) (*Config, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return parseConfig(data)
+}
+
+func parseConfig(data []byte) (*Config, error) {
+	var config Config
+	if err := yaml.UnmarshalStrict(data, &config); err != nil {
+		return nil, err
+	}
+	if err := config.validate(); err != nil {
+		return nil, err
+	}
+	return &config, nil
+}
+
+func (c *Config) validate() error {
+	for i, b := range c.NamespaceCABundles {
+		if b.CABundle == "" {
+			return fmt.Errorf("namespaceCABundles[%d]: caBundle is required", i)
+		}
+		if len(b.Namespaces) == 0 && b.NamespaceSelector == "" {
+			return fmt.Errorf("namespaceCABundles[%d]: either namespaces or namespaceSelector is required", i)
+		}
+		if _, err := labels.Parse(b.NamespaceSelector); err != nil {
+			return fmt.Errorf("namespaceCABundles[%d]: invalid namespaceSelector: %v", i, err)
+		}
+	}
+	for i, p := range c.RequiredPolicies {
+		if !oidRegex.MatchString(p.PolicyOID) {
+			return fmt.Errorf("requiredPolicies[%d]: invalid policyOID %q, it must be a dotted OID such as 1.3.6.1.4.1.1", i, p.PolicyOID)
+		}
+	}
+	return nil
+}
+
+// requiredPolicyOIDs returns the policy OIDs the leaf certificate of the service must carry
+func (c *Config) requiredPolicyOIDs(namespace string, service string) []string {
+	var oids []string
+	for _, p := range c.RequiredPolicies {
+		if (len(p.Namespaces) == 0 || contains(p.Namespaces, namespace)) && (len(p.Services) == 0 || contains(p.Services, service)) {
+			oids = append(oids, p.PolicyOID)
+		}
+	}
+	return oids
+}
+
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
+
+var (
+	yamlLineRegex     = regexp.MustCompile(`line (\d+)`)
+	unknownFieldRegex = regexp.MustCompile(`unknown field "([^"]+)"`)
+)
+
+// validateConfigFile parses and checks the config file as the daemon does at startup, CA bundles included,
+// and prints the outcome. It returns the exit code of -validate-config
+func validateConfigFile(w io.Writer, path string) int {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		fmt.Fprintf(w, "Could not read the config file: %v\n", err)
+		return 1
+	}
+
+	config, err := parseConfig(data)
+	if err == nil {
+		_, err = newTrustStore(config, nil)
+	}
+	if err != nil {
+		fmt.Fprintf(w, "%s: %v\n", path, err)
+		if line := errorLine(data, err); line > 0 {
+			printLineContext(w, data, line)
+		}
+		return 1
+	}
+
+	fmt.Fprintf(w, "%s: valid\n", path)
+	return 0
+}
+
+// errorLine finds the line of the config file the error refers to, 0 if unknown.
+// The YAML syntax errors carry the line, the unknown fields are looked up by name
+func errorLine(data []byte, err error) int {
+	if match := yamlLineRegex.FindStringSubmatch(err.Error()); match != nil {
+		line, _ := strconv.Atoi(match[1])
+		return line
+	}
+	if match := unknownFieldRegex.FindStringSubmatch(err.Error()); match != nil {
+		for i, line := range strings.Split(string(data), "\n") {
+			if strings.HasPrefix(strings.TrimLeft(line, " -"), match[1]+":") {
+				return i + 1
+			}
+		}
+	}
+	return 0
+}
+
+// printLineContext prints the given line of the file, marked, between its neighbours
+func printLineContext(w io.Writer, data []byte, line int) {
+	lines := strings.Split(strings.TrimRight(string(data), "\n"), "\n")
+	for i := line - 2; i <= line+2; i++ {
+		if i < 1 || i > len(lines) {
+			continue
+		}
+		marker := " "
+		if i == line {
+			marker = ">"
+		}
+		fmt.Fprintf(w, "%s %4d | %s\n", marker, i, lines[i-1])
+	}
+}
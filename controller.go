@@ -0,0 +1,152 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/rest"
+	"sigs.k8s.io/controller-runtime/pkg/builder"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/manager"
+	"sigs.k8s.io/controller-runtime/pkg/predicate"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+
+	log "github.com/sirupsen/logrus"
+)
+
+var certCheckKind = schema.GroupVersionKind{Group: "verify-k8s-certs.io", Version: "v1alpha1", Kind: "CertCheck"}
+
+// CertCheckSpec declares the service port of the CertCheck namespace that must serve a valid certificate
+type CertCheckSpec struct {
+	Service string `json:"service"`
+	Port    int32  `json:"port"`
+}
+
+// CertCheckStatus is the outcome of the latest probe of a CertCheck
+type CertCheckStatus struct {
+	Conditions    []metav1.Condition `json:"conditions,omitempty"`
+	NotAfter      *metav1.Time       `json:"notAfter,omitempty"`
+	SerialNumber  string             `json:"serialNumber,omitempty"`
+	LastProbeTime *metav1.Time       `json:"lastProbeTime,omitempty"`
+}
+
+// certCheckReconciler is the controller-runtime reconciler of the CertCheck resources: it probes the target of
+// every CertCheck and writes the result into its status. A CertCheck is reconciled when its spec changes and
+// again every resync period.
+type certCheckReconciler struct {
+	client client.Client
+	probe  probeOptions
+	resync time.Duration
+}
+
+// newCertCheck returns an empty CertCheck, handled as unstructured content as there is no generated type for it
+func newCertCheck() *unstructured.Unstructured {
+	check := &unstructured.Unstructured{}
+	check.SetGroupVersionKind(certCheckKind)
+	return check
+}
+
+func runController(opts probeOptions, resync time.Duration) {
+	config, err := rest.InClusterConfig()
+	if err != nil {
+		panic(err.Error())
+	}
+
+	/* the metrics are served by the daemon itself, the ones of the manager are not exposed */
+	mgr, err := manager.New(config, manager.Options{MetricsBindAddress: "0", HealthProbeBindAddress: "0"})
+	if err != nil {
+		panic(err.Error())
+	}
+
+	err = builder.ControllerManagedBy(mgr).
+		/* skip the updates of the status written by the reconciler itself, the resync is a requeue */
+		For(newCertCheck(), builder.WithPredicates(predicate.GenerationChangedPredicate{})).
+		Complete(&certCheckReconciler{client: mgr.GetClient(), probe: opts, resync: resync})
+	if err != nil {
+		panic(err.Error())
+	}
+
+	log.Infof("Reconciling the CertCheck resources every %v", resync)
+	if err := mgr.Start(context.Background()); err != nil {
+		panic(err.Error())
+	}
+}
+
+func (r *certCheckReconciler) Reconcile(ctx context.Context, req reconcile.Request) (reconcile.Result, error) {
+	check := newCertCheck()
+	if err := r.client.Get(ctx, req.NamespacedName, check); err != nil {
+		/* deleted since it was queued */
+		return reconcile.Result{}, client.IgnoreNotFound(err)
+	}
+
+	if err := r.reconcile(ctx, check); err != nil {
+		log.Errorf("Could not reconcile CertCheck %s: %v", req.NamespacedName, err)
+		return reconcile.Result{}, err
+	}
+	return reconcile.Result{RequeueAfter: r.resync}, nil
+}
+
+func (r *certCheckReconciler) reconcile(ctx context.Context, check *unstructured.Unstructured) error {
+	var spec CertCheckSpec
+	if content, found := check.Object["spec"].(map[string]interface{}); found {
+		if err := runtime.DefaultUnstructuredConverter.FromUnstructured(content, &spec); err != nil {
+			return err
+		}
+	}
+
+	var status CertCheckStatus
+	if content, found := check.Object["status"].(map[string]interface{}); found {
+		if err := runtime.DefaultUnstructuredConverter.FromUnstructured(content, &status); err != nil {
+			return err
+		}
+	}
+
+	r.updateStatus(&status, spec, check.GetNamespace(), check.GetGeneration())
+
+	content, err := runtime.DefaultUnstructuredConverter.ToUnstructured(&status)
+	if err != nil {
+		return err
+	}
+	check.Object["status"] = content
+
+	return r.client.Status().Update(ctx, check)
+}
+
+// updateStatus probes the target of the spec and sets the Ready and Expired conditions
+func (r *certCheckReconciler) updateStatus(status *CertCheckStatus, spec CertCheckSpec, namespace string, generation int64) {
+	now := metav1.Now()
+	status.LastProbeTime = &now
+
+	ready := metav1.Condition{Type: "Ready", ObservedGeneration: generation}
+	expired := metav1.Condition{Type: "Expired", Status: metav1.ConditionUnknown, ObservedGeneration: generation}
+
+	if spec.Service == "" || spec.Port <= 0 {
+		ready.Status, ready.Reason, ready.Message = metav1.ConditionFalse, "InvalidSpec", "spec.service and spec.port are required"
+		expired.Reason = "InvalidSpec"
+	} else if result := testTLS(r.probe, spec.Service, namespace, spec.Port); !result.Success {
+		ready.Status, ready.Reason, ready.Message = metav1.ConditionFalse, "ProbeFailed", result.Error.Error()
+		expired.Reason = "ProbeFailed"
+	} else {
+		leaf := result.Leaf()
+		notAfter := metav1.NewTime(leaf.NotAfter)
+		status.NotAfter = &notAfter
+		status.SerialNumber = leaf.SerialNumber.String()
+
+		if time.Now().After(leaf.NotAfter) {
+			ready.Status, ready.Reason, ready.Message = metav1.ConditionFalse, "Expired", fmt.Sprintf("the certificate expired on %s", leaf.NotAfter.Format(time.RFC3339))
+			expired.Status, expired.Reason = metav1.ConditionTrue, "Expired"
+		} else {
+			ready.Status, ready.Reason, ready.Message = metav1.ConditionTrue, "Valid", fmt.Sprintf("the certificate expires on %s", leaf.NotAfter.Format(time.RFC3339))
+			expired.Status, expired.Reason = metav1.ConditionFalse, "Valid"
+		}
+	}
+
+	meta.SetStatusCondition(&status.Conditions, ready)
+	meta.SetStatusCondition(&status.Conditions, expired)
+}
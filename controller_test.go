@@ -0,0 +1,64 @@
+package main
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"k8s.io/apimachinery/pkg/api/meta"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+)
+
+func TestReconcileInvalidCertCheck(t *testing.T) {
+	check := newCertCheck()
+	check.SetNamespace("payments")
+	check.SetName("api")
+	check.SetGeneration(3)
+	check.Object["spec"] = map[string]interface{}{"service": "payments-api"} /* the port is missing */
+
+	c := fake.NewClientBuilder().WithRuntimeObjects(check).Build()
+	r := &certCheckReconciler{client: c, probe: probeOptions{timeout: time.Second}, resync: time.Hour}
+
+	name := types.NamespacedName{Namespace: "payments", Name: "api"}
+	result, err := r.Reconcile(context.Background(), reconcile.Request{NamespacedName: name})
+	if err != nil {
+		t.Fatalf("Reconcile() failed: %v", err)
+	}
+	if result.RequeueAfter != time.Hour {
+		t.Errorf("Reconcile() requeues after %v, expected the resync period", result.RequeueAfter)
+	}
+
+	updated := newCertCheck()
+	if err := c.Get(context.Background(), name, updated); err != nil {
+		t.Fatal(err)
+	}
+	var status CertCheckStatus
+	if err := runtime.DefaultUnstructuredConverter.FromUnstructured(updated.Object["status"].(map[string]interface{}), &status); err != nil {
+		t.Fatal(err)
+	}
+	ready := meta.FindStatusCondition(status.Conditions, "Ready")
+	if ready == nil || ready.Status != "False" || ready.Reason != "InvalidSpec" || ready.ObservedGeneration != 3 {
+		t.Errorf("Ready condition = %+v, expected False with reason InvalidSpec for generation 3", ready)
+	}
+	if expired := meta.FindStatusCondition(status.Conditions, "Expired"); expired == nil || expired.Status != "Unknown" {
+		t.Errorf("Expired condition = %+v, expected Unknown", expired)
+	}
+	if status.LastProbeTime == nil {
+		t.Error("the probe time is missing from the status")
+	}
+}
+
+func TestReconcileDeletedCertCheck(t *testing.T) {
+	r := &certCheckReconciler{client: fake.NewClientBuilder().Build(), resync: time.Hour}
+
+	result, err := r.Reconcile(context.Background(), reconcile.Request{NamespacedName: types.NamespacedName{Namespace: "payments", Name: "gone"}})
+	if err != nil {
+		t.Errorf("Reconcile() of a deleted CertCheck failed: %v", err)
+	}
+	if result != (reconcile.Result{}) {
+		t.Errorf("Reconcile() of a deleted CertCheck = %+v, expected no requeue", result)
+	}
+}
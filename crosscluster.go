@@ -0,0 +1,144 @@
+package main
+
+import (
+	"crypto/x509"
+	"net"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	log "github.com/sirupsen/logrus"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/rest"
+	"k8s.io/client-go/tools/clientcmd"
+)
+
+var crossClusterUnmatchedGauge = promauto.NewGaugeVec(prometheus.GaugeOpts{
+	Name: "tls_verifier_cross_cluster_unmatched_services",
+	Help: "How many service ports probed in the latest scan have no equivalent in the other cluster, by the cluster they were found in (local or peer)",
+}, []string{"cluster"})
+
+// newPeerClientset connects to the API server of the peer cluster, with the current context of its kubeconfig
+// or, without a kubeconfig, with the token of a service account of that cluster
+func newPeerClientset(apiServer string, kubeconfig string, tokenFile string, caFile string) (*kubernetes.Clientset, error) {
+	if kubeconfig != "" {
+		/* the API server, when set, overrides the server of the kubeconfig */
+		config, err := clientcmd.BuildConfigFromFlags(apiServer, kubeconfig)
+		if err != nil {
+			return nil, err
+		}
+		return kubernetes.NewForConfig(config)
+	}
+
+	return kubernetes.NewForConfig(&rest.Config{
+		Host:            apiServer,
+		BearerTokenFile: tokenFile,
+		TLSClientConfig: rest.TLSClientConfig{CAFile: caFile},
+	})
+}
+
+// crossClusterLeaf is the leaf presented by a service port of the local cluster, with the target it was probed as
+type crossClusterLeaf struct {
+	target scanTarget
+	leaf   *x509.Certificate /* nil when the probe failed */
+}
+
+// probePeer probes the service ports of the peer cluster on the first external address of their services, presenting
+// the cluster DNS name of the service as SNI. It returns the presented leaves keyed by namespace/service:port, nil
+// when the probe failed. The services not exposed outside of the peer cluster cannot be probed and are left out.
+func probePeer(clientset *kubernetes.Clientset, opts scanOptions, skip *regexp.Regexp) (map[string]*x509.Certificate, error) {
+	services, err := listServices(clientset, opts, skip)
+	if err != nil {
+		return nil, err
+	}
+
+	leaves := make(map[string]*x509.Certificate)
+	for _, svc := range services {
+		ns, svcName := svc.namespace, svc.name
+		addrs := svc.externalAddresses
+		if len(addrs) == 0 {
+			log.Debugf("Service %s/%s of the peer cluster is not exposed outside of it, it cannot be compared", ns, svcName)
+			continue
+		}
+
+		for _, port := range svc.ports {
+			result := ProbeResult{
+				Namespace: ns,
+				Service:   svcName,
+				Port:      port.port,
+				Address:   net.JoinHostPort(addrs[0], strconv.Itoa(int(port.port))),
+				External:  true,
+			}
+			result = probeAddress(opts.probe, result, serviceHostname(svcName, ns))
+			if !result.Success {
+				log.Debugf("Could not probe %s of the peer cluster: %v", result.Address, result.Error)
+			}
+			leaves[targetKey(ns, svcName, port.port)] = result.Leaf()
+		}
+	}
+	return leaves, nil
+}
+
+// sameCertificate tells whether the two clusters serve an equivalent leaf: the same certificate, or a certificate
+// rotated independently but valid for the same names. Two certificates without any SAN only match by fingerprint
+func sameCertificate(local *x509.Certificate, peer *x509.Certificate) bool {
+	if local == nil || peer == nil {
+		return false
+	}
+	if fingerprint(local) == fingerprint(peer) {
+		return true
+	}
+	names := sortedNames(local)
+	return names != "" && names == sortedNames(peer)
+}
+
+// sortedNames joins the DNS, URI and IP address SANs of the certificate in a stable order
+func sortedNames(cert *x509.Certificate) string {
+	names := make([]string, 0, len(cert.DNSNames)+len(cert.URIs)+len(cert.IPAddresses))
+	for _, name := range cert.DNSNames {
+		names = append(names, "dns:"+name)
+	}
+	for _, uri := range cert.URIs {
+		names = append(names, "uri:"+uri.String())
+	}
+	for _, ip := range cert.IPAddresses {
+		names = append(names, "ip:"+ip.String())
+	}
+	sort.Strings(names)
+	return strings.Join(names, ",")
+}
+
+// compareClusters emits the match of every service port found in both clusters and counts the other ones
+func compareClusters(series *seriesGuard, local map[string]crossClusterLeaf, peer map[string]*x509.Certificate) {
+	unmatchedLocal, unmatchedPeer := 0, 0
+
+	for key, l := range local {
+		peerLeaf, found := peer[key]
+		if !found {
+			log.Debugf("%s has no equivalent in the peer cluster", key)
+			unmatchedLocal++
+			continue
+		}
+
+		match := sameCertificate(l.leaf, peerLeaf)
+		if !match {
+			log.Warnf("%s does not serve the same certificate in the local and in the peer cluster", key)
+		}
+		t := l.target
+		series.set(crossClusterMatchGauge, t.labelValues(t.namespace, t.service, strconv.Itoa(int(t.port))), boolToFloat(match))
+	}
+
+	for key := range peer {
+		if _, found := local[key]; !found {
+			log.Debugf("%s of the peer cluster has no equivalent in the local cluster", key)
+			unmatchedPeer++
+		}
+	}
+
+	log.Infof("Compared the certificates with the peer cluster: %d service ports only in the local cluster, %d only in the peer cluster", unmatchedLocal, unmatchedPeer)
+	crossClusterUnmatchedGauge.WithLabelValues("local").Set(float64(unmatchedLocal))
+	crossClusterUnmatchedGauge.WithLabelValues("peer").Set(float64(unmatchedPeer))
+}
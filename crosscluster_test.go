@@ -0,0 +1,57 @@
+package main
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+)
+
+const testKubeconfig = `apiVersion: v1
+kind: Config
+clusters:
+- name: peer
+  cluster:
+    server: https://peer.example.com:6443
+users:
+- name: verifier
+  user:
+    token: secret
+contexts:
+- name: peer
+  context:
+    cluster: peer
+    user: verifier
+current-context: peer
+`
+
+func TestNewPeerClientsetFromKubeconfig(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "kubeconfig")
+	if err := ioutil.WriteFile(path, []byte(testKubeconfig), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name      string
+		apiServer string
+		host      string
+	}{
+		{"current context", "", "peer.example.com:6443"},
+		{"API server overridden", "https://other.example.com", "other.example.com"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			clientset, err := newPeerClientset(tt.apiServer, path, "", "")
+			if err != nil {
+				t.Fatalf("newPeerClientset() failed: %v", err)
+			}
+			if host := clientset.CoreV1().RESTClient().Get().URL().Host; host != tt.host {
+				t.Errorf("the peer clientset talks to %s, expected %s", host, tt.host)
+			}
+		})
+	}
+
+	if _, err := newPeerClientset("", filepath.Join(t.TempDir(), "missing"), "", ""); err == nil {
+		t.Error("newPeerClientset() accepted a missing kubeconfig")
+	}
+}
@@ -0,0 +1,53 @@
+package main
+
+import (
+	"crypto/ecdsa"
+	"crypto/x509"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+/* the curves crypto/x509 parses ECDSA public keys on */
+var knownCurves = map[string]bool{"P-224": true, "P-256": true, "P-384": true, "P-521": true}
+
+// curveName returns the name of the curve of the ECDSA public key of the certificate, empty for the other key types
+func curveName(cert *x509.Certificate) string {
+	key, ok := cert.PublicKey.(*ecdsa.PublicKey)
+	if !ok || key.Curve == nil {
+		return ""
+	}
+	return key.Curve.Params().Name
+}
+
+// curveSet holds the curves the ECDSA certificates are allowed on, an empty set allows every curve
+type curveSet map[string]bool
+
+// parseCurves parses the comma separated list of -allowed-curves
+func parseCurves(list string) (curveSet, error) {
+	curves := make(curveSet)
+	for _, curve := range strings.Split(list, ",") {
+		if curve = strings.TrimSpace(curve); curve == "" {
+			continue
+		}
+		if !knownCurves[curve] {
+			return nil, fmt.Errorf("unknown curve %q, it must be one of %s", curve, strings.Join(sortedCurves(), ", "))
+		}
+		curves[curve] = true
+	}
+	return curves, nil
+}
+
+func sortedCurves() []string {
+	curves := make([]string, 0, len(knownCurves))
+	for curve := range knownCurves {
+		curves = append(curves, curve)
+	}
+	sort.Strings(curves)
+	return curves
+}
+
+// allows tells whether the curve is in the set
+func (s curveSet) allows(curve string) bool {
+	return len(s) == 0 || s[curve]
+}
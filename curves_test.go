@@ -0,0 +1,89 @@
+package main
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"testing"
+)
+
+func TestCurves(t *testing.T) {
+	allowed, err := parseCurves("P-256, P-384")
+	if err != nil {
+		t.Fatal(err)
+	}
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name    string
+		curve   elliptic.Curve /* nil for the RSA key */
+		want    string
+		allowed bool
+	}{
+		{"P-224", elliptic.P224(), "P-224", false},
+		{"P-256", elliptic.P256(), "P-256", true},
+		{"P-384", elliptic.P384(), "P-384", true},
+		{"P-521", elliptic.P521(), "P-521", false},
+		{"RSA", nil, "", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			template := leafTemplate("leaf")
+			var cert *x509.Certificate
+			if tt.curve == nil {
+				cert = issueTestCert(t, template, rsaKey, nil, nil)
+			} else {
+				key, err := ecdsa.GenerateKey(tt.curve, rand.Reader)
+				if err != nil {
+					t.Fatal(err)
+				}
+				cert = issueTestCert(t, template, key, nil, nil)
+			}
+
+			curve := curveName(cert)
+			if curve != tt.want {
+				t.Fatalf("curveName() = %q, expected %q", curve, tt.want)
+			}
+			/* the RSA leaves are left out of the curve policy by the caller */
+			if curve != "" && allowed.allows(curve) != tt.allowed {
+				t.Errorf("allows(%q) = %v, expected %v", curve, !tt.allowed, tt.allowed)
+			}
+		})
+	}
+}
+
+func TestParseCurves(t *testing.T) {
+	tests := []struct {
+		list  string
+		valid bool
+		size  int
+	}{
+		{"", true, 0},
+		{"P-256", true, 1},
+		{" P-224 ,P-521,", true, 2},
+		{"P-256,P-999", false, 0},
+		{"secp256r1", false, 0},
+	}
+
+	for _, tt := range tests {
+		curves, err := parseCurves(tt.list)
+		if (err == nil) != tt.valid {
+			t.Errorf("parseCurves(%q) error: %v, expected valid: %v", tt.list, err, tt.valid)
+			continue
+		}
+		if len(curves) != tt.size {
+			t.Errorf("parseCurves(%q) = %v, expected %d curves", tt.list, curves, tt.size)
+		}
+	}
+
+	var none curveSet
+	if !none.allows("P-521") {
+		t.Errorf("an empty set does not allow every curve")
+	}
+}
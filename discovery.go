@@ -0,0 +1,160 @@
+package main
+
+import (
+	"context"
+	"regexp"
+	"sync"
+
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// discoveredService holds what a scan needs of a service, so that the whole Service objects of huge clusters are not
+// kept in memory until the end of the listing
+type discoveredService struct {
+	namespace         string
+	name              string
+	ports             []servicePort
+	owner             string /* value of its -owner-label-key label */
+	expiresAt         string /* value of its expiresAtAnnotation annotation */
+	tlsSecret         string /* value of its tlsSecretAnnotation annotation */
+	externalAddresses []string
+}
+
+type servicePort struct {
+	name string
+	port int32
+}
+
+func newDiscoveredService(svc corev1.Service, opts scanOptions) discoveredService {
+	d := discoveredService{
+		namespace:         svc.GetNamespace(),
+		name:              svc.GetName(),
+		expiresAt:         svc.GetAnnotations()[expiresAtAnnotation],
+		tlsSecret:         svc.GetAnnotations()[tlsSecretAnnotation],
+		externalAddresses: externalAddresses(svc),
+	}
+	if opts.ownerLabelKey != "" {
+		d.owner = svc.GetLabels()[opts.ownerLabelKey]
+	}
+	for _, port := range svc.Spec.Ports {
+		d.ports = append(d.ports, servicePort{name: port.Name, port: port.Port})
+	}
+	return d
+}
+
+// listServices lists the services of the cluster, with a single List call or, with -list-per-namespace,
+// with one List call per namespace issued by a bounded number of workers. The skipped namespaces are
+// not listed at all. The client QPS and burst limits apply to all the calls.
+// The services are listed in pages of -list-page-size and filtered page by page, so that only the fields needed by
+// the scan of the services to probe are kept in memory, not the whole list of the cluster.
+func listServices(clientset *kubernetes.Clientset, opts scanOptions, skip *regexp.Regexp) ([]discoveredService, error) {
+	keep := func(svc corev1.Service) bool {
+		if skip != nil && skip.MatchString(svc.GetNamespace()) {
+			log.Infof("Skipping service:%s in namespace: %s", svc.GetName(), svc.GetNamespace())
+			return false
+		}
+		if opts.matchAnnotationKey != "" && svc.GetAnnotations()[opts.matchAnnotationKey] != opts.matchAnnotationValue {
+			log.Debugf("Skipping service:%s in namespace: %s, its %s annotation does not match", svc.GetName(), svc.GetNamespace(), opts.matchAnnotationKey)
+			return false
+		}
+		return true
+	}
+
+	if !opts.listPerNamespace {
+		return listServicePages(clientset, "", opts, keep)
+	}
+
+	namespaces, err := clientset.CoreV1().Namespaces().List(context.TODO(), metav1.ListOptions{})
+	if err != nil {
+		return nil, err
+	}
+
+	names := make(chan string)
+	var (
+		lock     sync.Mutex
+		services []discoveredService
+		wg       sync.WaitGroup
+	)
+
+	for i := 0; i < opts.discoveryConcurrency; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for ns := range names {
+				list, err := listServicePages(clientset, ns, opts, keep)
+				if err != nil {
+					log.Errorf("Could not list the services of namespace %s: %v", ns, err)
+					continue
+				}
+				lock.Lock()
+				services = append(services, list...)
+				lock.Unlock()
+			}
+		}()
+	}
+
+	for _, ns := range namespaces.Items {
+		if skip != nil && skip.MatchString(ns.GetName()) {
+			continue
+		}
+		names <- ns.GetName()
+	}
+	close(names)
+	wg.Wait()
+
+	return services, nil
+}
+
+/* how many times a listing starts again from the first page when its continue token expired */
+const maxListRestarts = 3
+
+// listServicePages lists the services of the namespace, all of them when empty, one page of -list-page-size
+// at a time, keeping the ones accepted by keep. A page size of 0 lists all the services with a single call.
+// When the continue token expires before the last page (410 Gone), the listing starts again from the first page
+func listServicePages(clientset *kubernetes.Clientset, namespace string, opts scanOptions, keep func(corev1.Service) bool) ([]discoveredService, error) {
+	listOptions := metav1.ListOptions{FieldSelector: opts.fieldSelector, Limit: opts.listPageSize}
+
+	var services []discoveredService
+	for restarts := 0; ; {
+		page, err := clientset.CoreV1().Services(namespace).List(context.TODO(), listOptions)
+		if listOptions.Continue != "" && restarts < maxListRestarts && (apierrors.IsResourceExpired(err) || apierrors.IsGone(err)) {
+			/* the pages listed so far are dropped, the services may have changed since the first one */
+			restarts++
+			log.Warnf("The continue token of the list of the services expired, listing them again from the first page (%d/%d): %v", restarts, maxListRestarts, err)
+			listOptions.Continue = ""
+			services = nil
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		for _, svc := range page.Items {
+			if keep(svc) {
+				services = append(services, newDiscoveredService(svc, opts))
+			}
+		}
+		if page.Continue == "" {
+			return services, nil
+		}
+		listOptions.Continue = page.Continue
+	}
+}
+
+// externalAddresses returns the addresses the service is exposed on outside of the cluster:
+// the ingress points of its load balancer and its external IPs
+func externalAddresses(svc corev1.Service) []string {
+	var addrs []string
+	for _, ingress := range svc.Status.LoadBalancer.Ingress {
+		if ingress.Hostname != "" {
+			addrs = append(addrs, ingress.Hostname)
+		} else if ingress.IP != "" {
+			addrs = append(addrs, ingress.IP)
+		}
+	}
+	return append(addrs, svc.Spec.ExternalIPs...)
+}
@@ -0,0 +1,144 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"sync"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/rest"
+)
+
+func TestNewDiscoveredService(t *testing.T) {
+	svc := corev1.Service{
+		ObjectMeta: metav1.ObjectMeta{
+			Namespace: "payments",
+			Name:      "api",
+			Labels:    map[string]string{"team": "billing", "tier": "backend"},
+			Annotations: map[string]string{
+				expiresAtAnnotation: "2026-12-01T00:00:00Z",
+				tlsSecretAnnotation: "api-tls",
+				"unrelated":         "dropped",
+			},
+		},
+		Spec: corev1.ServiceSpec{
+			Ports:       []corev1.ServicePort{{Name: "https", Port: 443}, {Name: "grpc", Port: 8443}},
+			ExternalIPs: []string{"10.0.0.1"},
+		},
+		Status: corev1.ServiceStatus{LoadBalancer: corev1.LoadBalancerStatus{
+			Ingress: []corev1.LoadBalancerIngress{{Hostname: "api.example.com"}, {IP: "192.0.2.1"}},
+		}},
+	}
+
+	want := discoveredService{
+		namespace:         "payments",
+		name:              "api",
+		ports:             []servicePort{{name: "https", port: 443}, {name: "grpc", port: 8443}},
+		owner:             "billing",
+		expiresAt:         "2026-12-01T00:00:00Z",
+		tlsSecret:         "api-tls",
+		externalAddresses: []string{"api.example.com", "192.0.2.1", "10.0.0.1"},
+	}
+	if got := newDiscoveredService(svc, scanOptions{ownerLabelKey: "team"}); !reflect.DeepEqual(got, want) {
+		t.Errorf("newDiscoveredService() = %+v, want %+v", got, want)
+	}
+
+	want.owner = ""
+	if got := newDiscoveredService(svc, scanOptions{}); !reflect.DeepEqual(got, want) {
+		t.Errorf("newDiscoveredService() without -owner-label-key = %+v, want %+v", got, want)
+	}
+}
+
+// pagedServicesAPI serves the services one per page, the continue token of the second page expiring expirations times
+type pagedServicesAPI struct {
+	lock        sync.Mutex
+	names       []string
+	expirations int
+	lists       int
+}
+
+func (a *pagedServicesAPI) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	a.lock.Lock()
+	defer a.lock.Unlock()
+	a.lists++
+
+	w.Header().Set("Content-Type", "application/json")
+	index := 0
+	if token := r.URL.Query().Get("continue"); token != "" {
+		if a.expirations > 0 {
+			a.expirations--
+			w.WriteHeader(http.StatusGone)
+			json.NewEncoder(w).Encode(metav1.Status{
+				TypeMeta: metav1.TypeMeta{Kind: "Status", APIVersion: "v1"},
+				Status:   metav1.StatusFailure,
+				Reason:   metav1.StatusReasonExpired,
+				Code:     http.StatusGone,
+				Message:  "The provided continue parameter is too old",
+			})
+			return
+		}
+		json.Unmarshal([]byte(token), &index)
+	}
+
+	page := corev1.ServiceList{TypeMeta: metav1.TypeMeta{Kind: "ServiceList", APIVersion: "v1"}}
+	page.Items = []corev1.Service{{ObjectMeta: metav1.ObjectMeta{Namespace: "ns", Name: a.names[index]}}}
+	if index+1 < len(a.names) {
+		token, _ := json.Marshal(index + 1)
+		page.Continue = string(token)
+	}
+	json.NewEncoder(w).Encode(page)
+}
+
+func TestListServicePagesRestartsOnExpiredToken(t *testing.T) {
+	keepAll := func(corev1.Service) bool { return true }
+
+	tests := []struct {
+		name        string
+		expirations int
+		names       []string
+		lists       int
+	}{
+		{"no expiration", 0, []string{"a", "b", "c"}, 3},
+		{"one expiration", 1, []string{"a", "b", "c"}, 5},
+		{"too many expirations", maxListRestarts + 1, nil, 2 + 2*maxListRestarts},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			api := &pagedServicesAPI{names: []string{"a", "b", "c"}, expirations: tt.expirations}
+			server := httptest.NewServer(api)
+			defer server.Close()
+			clientset, err := kubernetes.NewForConfig(&rest.Config{Host: server.URL})
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			services, err := listServicePages(clientset, "", scanOptions{listPageSize: 1}, keepAll)
+			if tt.names == nil {
+				if err == nil {
+					t.Errorf("listServicePages() did not fail after %d restarts", maxListRestarts)
+				}
+			} else {
+				if err != nil {
+					t.Fatalf("listServicePages() failed: %v", err)
+				}
+				var names []string
+				for _, svc := range services {
+					names = append(names, svc.name)
+				}
+				/* the services of the pages listed before the expiration are not duplicated */
+				if !reflect.DeepEqual(names, tt.names) {
+					t.Errorf("listServicePages() = %v, expected %v", names, tt.names)
+				}
+			}
+			if api.lists != tt.lists {
+				t.Errorf("%d list calls, expected %d", api.lists, tt.lists)
+			}
+		})
+	}
+}
@@ -0,0 +1,64 @@
+package main
+
+import (
+	"context"
+	"net"
+	"strconv"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+)
+
+// listEndpoints returns the endpoints of all the services, indexed by namespace/name
+func listEndpoints(clientset *kubernetes.Clientset) (map[string]*corev1.Endpoints, error) {
+	list, err := clientset.CoreV1().Endpoints("").List(context.TODO(), metav1.ListOptions{})
+	if err != nil {
+		return nil, err
+	}
+
+	endpoints := make(map[string]*corev1.Endpoints, len(list.Items))
+	for i := range list.Items {
+		eps := &list.Items[i]
+		endpoints[eps.GetNamespace()+"/"+eps.GetName()] = eps
+	}
+	return endpoints, nil
+}
+
+// probeEndpoints probes every ready address backing the service port of the target,
+// presenting the service host name as SNI so that the same certificate is selected
+func probeEndpoints(opts probeOptions, target scanTarget, endpoints *corev1.Endpoints) []ProbeResult {
+	serverName := serviceHostname(target.service, target.namespace)
+
+	var results []ProbeResult
+	for _, subset := range endpoints.Subsets {
+		for _, port := range subset.Ports {
+			/* the ports of a multi-port service are matched by name */
+			if port.Name != target.portName {
+				continue
+			}
+
+			for _, addr := range subset.Addresses {
+				result := ProbeResult{
+					Namespace: target.namespace,
+					Service:   target.service,
+					Port:      target.port,
+					Address:   net.JoinHostPort(addr.IP, strconv.Itoa(int(port.Port))),
+				}
+				results = append(results, probeAddress(opts, result, serverName))
+			}
+		}
+	}
+	return results
+}
+
+// leafSerialSpread counts the distinct leaf serials among the successful probes
+func leafSerialSpread(results []ProbeResult) int {
+	serials := make(map[string]bool)
+	for _, result := range results {
+		if leaf := result.Leaf(); leaf != nil {
+			serials[leaf.SerialNumber.String()] = true
+		}
+	}
+	return len(serials)
+}
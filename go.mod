@@ -4,7 +4,11 @@ go 1.16
 
 require (
 	github.com/prometheus/client_golang v1.11.0
-	github.com/sirupsen/logrus v1.6.0
+	github.com/prometheus/client_model v0.2.0
+	github.com/sirupsen/logrus v1.7.0
+	k8s.io/api v0.21.3
 	k8s.io/apimachinery v0.21.3
 	k8s.io/client-go v0.21.3
+	sigs.k8s.io/controller-runtime v0.9.6
+	sigs.k8s.io/yaml v1.2.0
 )
@@ -0,0 +1,40 @@
+package main
+
+import "time"
+
+// graceTracker remembers when every target was first seen, so that the failures of the targets that just appeared,
+// e.g. still starting during a deploy, are not counted. It lives in memory: the targets found by the first scan after
+// a restart are considered known since ever, only the ones appearing afterwards get the grace period
+type graceTracker struct {
+	grace     time.Duration
+	firstSeen map[string]time.Time
+	started   bool
+}
+
+func newGraceTracker(grace time.Duration) *graceTracker {
+	return &graceTracker{grace: grace, firstSeen: make(map[string]time.Time)}
+}
+
+// update records the targets of a scan, the targets that disappeared are forgotten and get the grace period again if they come back
+func (g *graceTracker) update(targets []scanTarget) {
+	now := time.Now()
+	seen := make(map[string]time.Time, len(targets))
+	for _, target := range targets {
+		key := target.key()
+		if firstSeen, found := g.firstSeen[key]; found {
+			seen[key] = firstSeen
+		} else if g.started {
+			seen[key] = now
+		} else {
+			seen[key] = time.Time{}
+		}
+	}
+	g.firstSeen = seen
+	g.started = true
+}
+
+// inGrace tells whether the target was first seen less than the grace period ago
+func (g *graceTracker) inGrace(target scanTarget) bool {
+	firstSeen, found := g.firstSeen[target.key()]
+	return g.grace > 0 && found && time.Since(firstSeen) < g.grace
+}
@@ -0,0 +1,37 @@
+package main
+
+import (
+	"sync"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+var systemicFailureGauge = promauto.NewGauge(prometheus.GaugeOpts{
+	Name: "tls_verifier_systemic_failure",
+	Help: "1 if the ratio of the failed probes of the latest scan exceeded -unhealthy-failure-ratio, 0 otherwise",
+})
+
+// systemicFailure tells whether the latest scan failed too many probes, the healthz endpoint then fails too
+var systemicFailure struct {
+	sync.RWMutex
+	failing bool
+}
+
+// updateSystemicFailure compares the ratio of the failed probes of the scan with the threshold, 0 disables the check.
+// The ratio is over the probes actually attempted, not over the targets: with -resolve-all or -ip-family both a target
+// is probed more than once, and the targets left unprobed by -scan-timeout do not count
+func updateSystemicFailure(summary scanSummary, threshold float64) {
+	failing := threshold > 0 && summary.Probes > 0 && float64(summary.Failures)/float64(summary.Probes) > threshold
+
+	systemicFailure.Lock()
+	defer systemicFailure.Unlock()
+	systemicFailure.failing = failing
+	systemicFailureGauge.Set(boolToFloat(failing))
+}
+
+func isSystemicFailure() bool {
+	systemicFailure.RLock()
+	defer systemicFailure.RUnlock()
+	return systemicFailure.failing
+}
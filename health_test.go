@@ -0,0 +1,30 @@
+package main
+
+import "testing"
+
+func TestUpdateSystemicFailure(t *testing.T) {
+	tests := []struct {
+		name      string
+		summary   scanSummary
+		threshold float64
+		failing   bool
+	}{
+		{"disabled", scanSummary{Targets: 2, Probes: 2, Failures: 2}, 0, false},
+		{"nothing probed", scanSummary{Targets: 2}, 0.5, false},
+		{"below the threshold", scanSummary{Targets: 4, Probes: 4, Failures: 2}, 0.5, false},
+		{"above the threshold", scanSummary{Targets: 4, Probes: 4, Failures: 3}, 0.5, true},
+		/* -ip-family both on an IPv4-only cluster: two probes per target, one of them always fails */
+		{"one family unreachable", scanSummary{Targets: 4, Probes: 8, Failures: 4}, 0.5, false},
+		/* -scan-timeout left most of the targets unprobed, the ratio is over the probes that ran */
+		{"scan timeout", scanSummary{Targets: 100, Probes: 4, Failures: 3}, 0.5, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			updateSystemicFailure(tt.summary, tt.threshold)
+			if failing := isSystemicFailure(); failing != tt.failing {
+				t.Errorf("isSystemicFailure() = %v, expected %v", failing, tt.failing)
+			}
+		})
+	}
+}
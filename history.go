@@ -0,0 +1,99 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"sync"
+	"time"
+)
+
+const (
+	maxHistorySize = 100 /* upper bound of -history-size */
+
+	maxHistoryChanges = 10 /* targets listed for each kind of change, the others are only counted */
+)
+
+// historyChanges summarizes one kind of change since the previous scan: how many targets changed and the first of them
+type historyChanges struct {
+	Count   int      `json:"count"`
+	Targets []string `json:"targets,omitempty"`
+}
+
+// historyEntry summarizes a scan: its counts and the notable changes since the previous scan, not the certificates
+type historyEntry struct {
+	Timestamp   time.Time      `json:"timestamp"`
+	Targets     int            `json:"targets"`
+	Failures    int            `json:"failures"`
+	Expired     int            `json:"expired"`
+	Expiring    int            `json:"expiring"`
+	New         historyChanges `json:"new"`
+	Rotated     historyChanges `json:"rotated"`
+	Disappeared historyChanges `json:"disappeared"`
+	Flapped     historyChanges `json:"flapped"`
+}
+
+func summarizeChanges(entries []snapshotEntry) historyChanges {
+	changes := historyChanges{Count: len(entries)}
+	for i, e := range entries {
+		if i == maxHistoryChanges {
+			break
+		}
+		changes.Targets = append(changes.Targets, targetKey(e.Namespace, e.Service, e.Port))
+	}
+	return changes
+}
+
+func newHistoryEntry(summary scanSummary, d scanDiff) historyEntry {
+	return historyEntry{
+		Timestamp:   time.Now(),
+		Targets:     summary.Targets,
+		Failures:    summary.Failures,
+		Expired:     summary.Expired,
+		Expiring:    summary.Expiring,
+		New:         summarizeChanges(d.New),
+		Rotated:     summarizeChanges(d.Rotated),
+		Disappeared: summarizeChanges(d.Disappeared),
+		Flapped:     summarizeChanges(d.Flapped),
+	}
+}
+
+// scanHistory keeps the summaries of the latest scans, the oldest summary is dropped when it is full
+var scanHistory struct {
+	sync.RWMutex
+	size    int /* 0 keeps no summary */
+	entries []historyEntry
+}
+
+func setHistorySize(size int) {
+	scanHistory.Lock()
+	defer scanHistory.Unlock()
+	scanHistory.size = size
+}
+
+func recordHistory(entry historyEntry) {
+	scanHistory.Lock()
+	defer scanHistory.Unlock()
+
+	if scanHistory.size == 0 {
+		return
+	}
+	if len(scanHistory.entries) == scanHistory.size {
+		copy(scanHistory.entries, scanHistory.entries[1:])
+		scanHistory.entries = scanHistory.entries[:len(scanHistory.entries)-1]
+	}
+	scanHistory.entries = append(scanHistory.entries, entry)
+}
+
+// historyHandler serves the summaries of the latest scans, the oldest first
+func historyHandler(w http.ResponseWriter, r *http.Request) {
+	scanHistory.RLock()
+	defer scanHistory.RUnlock()
+
+	entries := scanHistory.entries
+	if entries == nil {
+		entries = []historyEntry{}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(entries)
+}
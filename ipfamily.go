@@ -0,0 +1,36 @@
+package main
+
+import "net"
+
+/* the networks dialed for every -ip-family, both probes ipv4 and ipv6 separately */
+var ipFamilyNetworks = map[string]string{"auto": "tcp", "ipv4": "tcp4", "ipv6": "tcp6"}
+
+// dialNetwork returns the network to dial for the IP family, tcp lets the dialer pick the family of the address
+func dialNetwork(family string) string {
+	if network, ok := ipFamilyNetworks[family]; ok {
+		return network
+	}
+	return "tcp"
+}
+
+// addressFamily returns ipv4 or ipv6, the IP family of the address
+func addressFamily(addr string) string {
+	if ip := net.ParseIP(addr); ip != nil && ip.To4() == nil {
+		return "ipv6"
+	}
+	return "ipv4"
+}
+
+// probeFamilies probes the target once per IP family, tagging every result with its family
+func probeFamilies(opts probeOptions, target scanTarget) []ProbeResult {
+	var results []ProbeResult
+	for _, family := range []string{"ipv4", "ipv6"} {
+		familyOpts := opts
+		familyOpts.ipFamily = family
+		for _, result := range probeTarget(familyOpts, target) {
+			result.IPFamily = family
+			results = append(results, result)
+		}
+	}
+	return results
+}
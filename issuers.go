@@ -0,0 +1,44 @@
+package main
+
+import (
+	"crypto/x509"
+	"strings"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+var ignoredCertsCounter = promauto.NewCounter(prometheus.CounterOpts{
+	Name: "tls_verifier_ignored_certs_total",
+	Help: "How many discovered certificates were not reported because their issuer is listed in -ignore-issuers",
+})
+
+// issuerSet holds the issuers, by common name or organization, whose certificates are not reported
+type issuerSet map[string]bool
+
+// parseIssuers parses the comma separated list of -ignore-issuers
+func parseIssuers(list string) issuerSet {
+	issuers := make(issuerSet)
+	for _, issuer := range strings.Split(list, ",") {
+		if issuer = strings.TrimSpace(issuer); issuer != "" {
+			issuers[issuer] = true
+		}
+	}
+	return issuers
+}
+
+// matches tells whether the issuer of the certificate is in the set, by common name or by any of its organizations
+func (s issuerSet) matches(cert *x509.Certificate) bool {
+	if len(s) == 0 || cert == nil {
+		return false
+	}
+	if s[cert.Issuer.CommonName] {
+		return true
+	}
+	for _, org := range cert.Issuer.Organization {
+		if s[org] {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,77 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+var inMaintenanceGauge = promauto.NewGauge(prometheus.GaugeOpts{
+	Name: "tls_verifier_in_maintenance",
+	Help: "1 if the latest scan was skipped because it fell in a maintenance window, 0 otherwise",
+})
+
+// maintenanceWindow is a daily time range, as offsets from midnight, wrapping around midnight when end is before start
+type maintenanceWindow struct {
+	start time.Duration
+	end   time.Duration
+}
+
+// maintenanceWindows are the daily time ranges, in a given time zone, during which the scans are skipped
+type maintenanceWindows struct {
+	windows  []maintenanceWindow
+	location *time.Location
+}
+
+// parseMaintenanceWindows parses the comma separated HH:MM-HH:MM ranges of -maintenance-window
+func parseMaintenanceWindows(spec string, location *time.Location) (*maintenanceWindows, error) {
+	m := &maintenanceWindows{location: location}
+	for _, r := range strings.Split(spec, ",") {
+		bounds := strings.Split(strings.TrimSpace(r), "-")
+		if len(bounds) != 2 {
+			return nil, fmt.Errorf("invalid range %q, it must be HH:MM-HH:MM", r)
+		}
+
+		var window maintenanceWindow
+		for i, bound := range bounds {
+			t, err := time.Parse("15:04", bound)
+			if err != nil {
+				return nil, fmt.Errorf("invalid range %q: %v", r, err)
+			}
+			offset := time.Duration(t.Hour())*time.Hour + time.Duration(t.Minute())*time.Minute
+			if i == 0 {
+				window.start = offset
+			} else {
+				window.end = offset
+			}
+		}
+		if window.start == window.end {
+			return nil, fmt.Errorf("invalid range %q, it is empty", r)
+		}
+		m.windows = append(m.windows, window)
+	}
+	return m, nil
+}
+
+// active tells whether the time falls in one of the windows, the start of a window is included and its end excluded.
+// No window is ever active on a nil receiver
+func (m *maintenanceWindows) active(now time.Time) bool {
+	if m == nil {
+		return false
+	}
+
+	local := now.In(m.location)
+	offset := time.Duration(local.Hour())*time.Hour + time.Duration(local.Minute())*time.Minute + time.Duration(local.Second())*time.Second
+	for _, w := range m.windows {
+		if w.start < w.end && offset >= w.start && offset < w.end {
+			return true
+		}
+		if w.start > w.end && (offset >= w.start || offset < w.end) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,80 @@
+package main
+
+import (
+	"context"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+)
+
+var (
+	namespaceProbeSuccessCounter = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "tls_verifier_namespace_probe_success_total",
+		Help: "How many probes of the service ports of the namespace succeeded",
+	}, []string{"namespace"})
+	namespaceProbeAttemptsCounter = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "tls_verifier_namespace_probe_attempts_total",
+		Help: "How many probes of the service ports of the namespace were attempted",
+	}, []string{"namespace"})
+)
+
+// countNamespaceProbe counts the probe in the success rate of its namespace
+func countNamespaceProbe(result ProbeResult) {
+	if result.Namespace == "" || result.Secret {
+		return /* not the probe of a service */
+	}
+
+	namespaceProbeAttemptsCounter.WithLabelValues(result.Namespace).Inc()
+	if result.Success {
+		namespaceProbeSuccessCounter.WithLabelValues(result.Namespace).Inc()
+	}
+}
+
+// forgetNamespaces drops the counters of the namespaces probed by the previous scan but not by the current one,
+// e.g. because they were deleted
+func forgetNamespaces(previous scanSnapshot, current scanSnapshot) {
+	probed := make(map[string]bool)
+	for _, entry := range current {
+		probed[entry.Namespace] = true
+	}
+
+	for _, entry := range previous {
+		if !probed[entry.Namespace] {
+			namespaceProbeAttemptsCounter.DeleteLabelValues(entry.Namespace)
+			namespaceProbeSuccessCounter.DeleteLabelValues(entry.Namespace)
+		}
+	}
+}
+
+// listNamespaceLabels returns the labels of all the namespaces, indexed by name
+func listNamespaceLabels(clientset *kubernetes.Clientset) (map[string]map[string]string, error) {
+	list, err := clientset.CoreV1().Namespaces().List(context.TODO(), metav1.ListOptions{})
+	if err != nil {
+		return nil, err
+	}
+
+	namespaceLabels := make(map[string]map[string]string, len(list.Items))
+	for _, ns := range list.Items {
+		namespaceLabels[ns.GetName()] = ns.GetLabels()
+	}
+	return namespaceLabels, nil
+}
+
+// listTerminatingNamespaces returns the names of the namespaces being deleted
+func listTerminatingNamespaces(clientset *kubernetes.Clientset) (map[string]bool, error) {
+	list, err := clientset.CoreV1().Namespaces().List(context.TODO(), metav1.ListOptions{
+		FieldSelector: "status.phase=" + string(corev1.NamespaceTerminating),
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	terminating := make(map[string]bool, len(list.Items))
+	for _, ns := range list.Items {
+		terminating[ns.GetName()] = true
+	}
+	return terminating, nil
+}
@@ -0,0 +1,53 @@
+package main
+
+import (
+	"fmt"
+	"io"
+)
+
+// scanSummary counts the problems found by a scan
+type scanSummary struct {
+	Targets  int
+	Probes   int /* probe results, one per address or IP family probed and per secret read */
+	Failures int /* probes that failed */
+	Expired  int /* certificates already expired */
+	Expiring int /* certificates expiring within -expiry-threshold */
+
+	Maintenance bool /* the scan was skipped, being in a maintenance window */
+}
+
+// onceExitCode decides the exit code of a -once run from the summary of its scan:
+// failOn is expiry (expired or expiring certificates), failures (failed probes) or both,
+// with requireTargets a scan that found nothing to probe fails too
+func onceExitCode(w io.Writer, summary scanSummary, failOn string, requireTargets bool) int {
+	fmt.Fprintf(w, "Probed %d service ports with %d probes: %d failed, %d certificates expired, %d expiring soon\n",
+		summary.Targets, summary.Probes, summary.Failures, summary.Expired, summary.Expiring)
+
+	if summary.Maintenance {
+		fmt.Fprintf(w, "Exiting with 0: the scan was skipped, being in a maintenance window\n")
+		return 0
+	}
+
+	if summary.Targets == 0 && requireTargets {
+		fmt.Fprintf(w, "Exiting with 1: no service port left to probe after filtering (-require-targets)\n")
+		return 1
+	}
+
+	expiryProblems := summary.Expired+summary.Expiring > 0
+	failureProblems := summary.Failures > 0
+
+	switch {
+	case (failOn == "expiry" || failOn == "both") && expiryProblems:
+		fmt.Fprintf(w, "Exiting with 1: certificates are expired or expiring soon (-fail-on %s)\n", failOn)
+		return 1
+	case (failOn == "failures" || failOn == "both") && failureProblems:
+		fmt.Fprintf(w, "Exiting with 1: some probes failed (-fail-on %s)\n", failOn)
+		return 1
+	case expiryProblems || failureProblems:
+		fmt.Fprintf(w, "Exiting with 0: the problems found are not considered with -fail-on %s\n", failOn)
+		return 0
+	default:
+		fmt.Fprintf(w, "Exiting with 0: no problem found\n")
+		return 0
+	}
+}
@@ -0,0 +1,104 @@
+package main
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func TestOnceExitCode(t *testing.T) {
+	clean := scanSummary{Targets: 3}
+	expiring := scanSummary{Targets: 3, Expiring: 1}
+	expired := scanSummary{Targets: 3, Expired: 1}
+	failed := scanSummary{Targets: 3, Failures: 1}
+	empty := scanSummary{}
+	maintenance := scanSummary{Maintenance: true}
+
+	tests := []struct {
+		name           string
+		summary        scanSummary
+		failOn         string
+		requireTargets bool
+		code           int
+	}{
+		{"clean, expiry", clean, "expiry", false, 0},
+		{"clean, failures", clean, "failures", false, 0},
+		{"clean, both", clean, "both", false, 0},
+		{"expiring, expiry", expiring, "expiry", false, 1},
+		{"expiring, failures", expiring, "failures", false, 0},
+		{"expiring, both", expiring, "both", false, 1},
+		{"expired, expiry", expired, "expiry", false, 1},
+		{"expired, failures", expired, "failures", false, 0},
+		{"expired, both", expired, "both", false, 1},
+		{"failed, expiry", failed, "expiry", false, 0},
+		{"failed, failures", failed, "failures", false, 1},
+		{"failed, both", failed, "both", false, 1},
+		{"no targets", empty, "both", false, 0},
+		{"no targets, require targets", empty, "both", true, 1},
+		{"clean, require targets", clean, "both", true, 0},
+		{"failed, require targets", failed, "failures", true, 1},
+		{"maintenance", maintenance, "both", false, 0},
+		{"maintenance, require targets", maintenance, "both", true, 0},
+		{"maintenance, expiry", maintenance, "expiry", true, 0},
+		{"maintenance, failures", maintenance, "failures", true, 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var out bytes.Buffer
+			code := onceExitCode(&out, tt.summary, tt.failOn, tt.requireTargets)
+			if code != tt.code {
+				t.Errorf("onceExitCode() = %d, expected %d, output:\n%s", code, tt.code, out.String())
+			}
+			if !strings.Contains(out.String(), "Exiting with ") {
+				t.Errorf("the output does not explain the exit code:\n%s", out.String())
+			}
+		})
+	}
+}
+
+func TestRunOnce(t *testing.T) {
+	scanned := false
+	modes := runModes{
+		once:   true,
+		failOn: "failures",
+		scan: func() scanSummary {
+			scanned = true
+			return scanSummary{Targets: 2, Probes: 2, Failures: 1}
+		},
+		reconcile: func() { t.Error("the controller was started by -once") },
+		pushOTLP:  func() { t.Error("the OTLP pusher was started by -once") },
+		serve: func() error {
+			t.Error("the HTTP server was started by -once")
+			return nil
+		},
+	}
+
+	var out bytes.Buffer
+	if code := run(&out, modes); code != 1 {
+		t.Errorf("run() = %d, expected 1, output:\n%s", code, out.String())
+	}
+	/* the scan ran before run returned, not in the background */
+	if !scanned {
+		t.Error("the scan did not run synchronously")
+	}
+	if !strings.Contains(out.String(), "Probed 2 service ports with 2 probes: 1 failed") {
+		t.Errorf("the summary is missing from the output:\n%s", out.String())
+	}
+}
+
+func TestHeartbeatOnlyInServeMode(t *testing.T) {
+	before := testutil.ToFloat64(hearthbeatCounter)
+
+	heartbeat(scanOptions{once: true})
+	if after := testutil.ToFloat64(hearthbeatCounter); after != before {
+		t.Errorf("a -once scan bumped the heartbeat from %v to %v", before, after)
+	}
+
+	heartbeat(scanOptions{})
+	if after := testutil.ToFloat64(hearthbeatCounter); after != before+1 {
+		t.Errorf("a scan of the serve mode bumped the heartbeat from %v to %v", before, after)
+	}
+}
@@ -0,0 +1,196 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+	log "github.com/sirupsen/logrus"
+)
+
+// otlpMetric maps a Prometheus metric to its OpenTelemetry name and unit
+type otlpMetric struct {
+	name string
+	unit string
+}
+
+/* the core metrics mirrored to OTLP, keyed by their Prometheus name */
+var otlpMirrored = map[string]otlpMetric{
+	"tls_verifier_seconds_to_expiration_tls_certificate":   {name: "tls_verifier.certificate.time_to_expiration", unit: "s"},
+	"tls_verifier_probe_failures_total":                    {name: "tls_verifier.probe.failures", unit: "{failure}"},
+	"tls_verifier_discovered_tls_certificates_of_services": {name: "tls_verifier.certificates.discovered", unit: "{certificate}"},
+}
+
+/* labels renamed after the OpenTelemetry semantic conventions, the others are kept as they are */
+var otlpAttributeNames = map[string]string{
+	"namespace": "k8s.namespace.name",
+	"service":   "k8s.service.name",
+	"port":      "server.port",
+}
+
+/* the subset of the OTLP/HTTP JSON encoding used by the exporter */
+type otlpRequest struct {
+	ResourceMetrics []otlpResourceMetrics `json:"resourceMetrics"`
+}
+
+type otlpResourceMetrics struct {
+	Resource     otlpResource       `json:"resource"`
+	ScopeMetrics []otlpScopeMetrics `json:"scopeMetrics"`
+}
+
+type otlpResource struct {
+	Attributes []otlpAttribute `json:"attributes"`
+}
+
+type otlpScopeMetrics struct {
+	Scope   otlpScope        `json:"scope"`
+	Metrics []otlpMetricData `json:"metrics"`
+}
+
+type otlpScope struct {
+	Name string `json:"name"`
+}
+
+type otlpMetricData struct {
+	Name        string     `json:"name"`
+	Description string     `json:"description,omitempty"`
+	Unit        string     `json:"unit,omitempty"`
+	Gauge       *otlpGauge `json:"gauge,omitempty"`
+	Sum         *otlpSum   `json:"sum,omitempty"`
+}
+
+type otlpGauge struct {
+	DataPoints []otlpDataPoint `json:"dataPoints"`
+}
+
+type otlpSum struct {
+	DataPoints             []otlpDataPoint `json:"dataPoints"`
+	AggregationTemporality int             `json:"aggregationTemporality"` /* 2 is cumulative */
+	IsMonotonic            bool            `json:"isMonotonic"`
+}
+
+type otlpDataPoint struct {
+	Attributes        []otlpAttribute `json:"attributes,omitempty"`
+	StartTimeUnixNano string          `json:"startTimeUnixNano,omitempty"`
+	TimeUnixNano      string          `json:"timeUnixNano"`
+	AsDouble          float64         `json:"asDouble"`
+}
+
+type otlpAttribute struct {
+	Key   string       `json:"key"`
+	Value otlpAnyValue `json:"value"`
+}
+
+type otlpAnyValue struct {
+	StringValue string `json:"stringValue"`
+}
+
+// otlpExporter pushes the core metrics to an OTLP/HTTP endpoint, e.g. an OpenTelemetry collector
+type otlpExporter struct {
+	endpoint string
+	interval time.Duration
+	gatherer prometheus.Gatherer
+	client   *http.Client
+	start    time.Time /* start of the cumulative sums */
+}
+
+func newOTLPExporter(endpoint string, interval time.Duration, gatherer prometheus.Gatherer) *otlpExporter {
+	return &otlpExporter{
+		endpoint: endpoint,
+		interval: interval,
+		gatherer: gatherer,
+		client:   &http.Client{Timeout: interval},
+		start:    time.Now(),
+	}
+}
+
+// run pushes the metrics every interval, the failed pushes are logged and not retried
+func (e *otlpExporter) run() {
+	log.Infof("Pushing the metrics to %s every %v", e.endpoint, e.interval)
+	for range time.Tick(e.interval) {
+		if err := e.push(); err != nil {
+			log.Errorf("Could not push the metrics to %s: %v", e.endpoint, err)
+		}
+	}
+}
+
+func (e *otlpExporter) push() error {
+	families, err := e.gatherer.Gather()
+	if err != nil {
+		return err
+	}
+
+	body, err := json.Marshal(newOTLPRequest(families, e.start, time.Now()))
+	if err != nil {
+		return err
+	}
+
+	resp, err := e.client.Post(e.endpoint, "application/json", bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode/100 != 2 {
+		return fmt.Errorf("unexpected status %s", resp.Status)
+	}
+	return nil
+}
+
+// newOTLPRequest converts the mirrored metrics among the gathered families: gauges stay gauges,
+// counters become cumulative monotonic sums
+func newOTLPRequest(families []*dto.MetricFamily, start time.Time, now time.Time) otlpRequest {
+	startNano := strconv.FormatInt(start.UnixNano(), 10)
+	nowNano := strconv.FormatInt(now.UnixNano(), 10)
+
+	var metrics []otlpMetricData
+	for _, family := range families {
+		mirrored, found := otlpMirrored[family.GetName()]
+		if !found {
+			continue
+		}
+
+		data := otlpMetricData{Name: mirrored.name, Description: family.GetHelp(), Unit: mirrored.unit}
+		var points []otlpDataPoint
+		for _, m := range family.GetMetric() {
+			point := otlpDataPoint{Attributes: otlpAttributes(m.GetLabel()), TimeUnixNano: nowNano}
+			switch family.GetType() {
+			case dto.MetricType_GAUGE:
+				point.AsDouble = m.GetGauge().GetValue()
+			case dto.MetricType_COUNTER:
+				point.AsDouble = m.GetCounter().GetValue()
+				point.StartTimeUnixNano = startNano
+			}
+			points = append(points, point)
+		}
+
+		if family.GetType() == dto.MetricType_COUNTER {
+			data.Sum = &otlpSum{DataPoints: points, AggregationTemporality: 2, IsMonotonic: true}
+		} else {
+			data.Gauge = &otlpGauge{DataPoints: points}
+		}
+		metrics = append(metrics, data)
+	}
+
+	return otlpRequest{ResourceMetrics: []otlpResourceMetrics{{
+		Resource:     otlpResource{Attributes: []otlpAttribute{{Key: "service.name", Value: otlpAnyValue{StringValue: "verify-k8s-certs"}}}},
+		ScopeMetrics: []otlpScopeMetrics{{Scope: otlpScope{Name: "verify-k8s-certs"}, Metrics: metrics}},
+	}}}
+}
+
+func otlpAttributes(labels []*dto.LabelPair) []otlpAttribute {
+	attributes := make([]otlpAttribute, 0, len(labels))
+	for _, label := range labels {
+		key := label.GetName()
+		if renamed, found := otlpAttributeNames[key]; found {
+			key = renamed
+		}
+		attributes = append(attributes, otlpAttribute{Key: key, Value: otlpAnyValue{StringValue: label.GetValue()}})
+	}
+	return attributes
+}
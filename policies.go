@@ -0,0 +1,24 @@
+package main
+
+import "crypto/x509"
+
+// policyOIDs returns the certificate policy OIDs carried by the certificate, in dotted form
+func policyOIDs(cert *x509.Certificate) []string {
+	oids := make([]string, 0, len(cert.PolicyIdentifiers))
+	for _, oid := range cert.PolicyIdentifiers {
+		oids = append(oids, oid.String())
+	}
+	return oids
+}
+
+// missingPolicies returns the required policy OIDs the certificate does not carry
+func missingPolicies(cert *x509.Certificate, required []string) []string {
+	carried := policyOIDs(cert)
+	var missing []string
+	for _, oid := range required {
+		if !contains(carried, oid) {
+			missing = append(missing, oid)
+		}
+	}
+	return missing
+}
@@ -0,0 +1,45 @@
+package main
+
+import (
+	"io/ioutil"
+	stdlog "log"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func openFDs(t *testing.T) int {
+	t.Helper()
+	fds, err := ioutil.ReadDir("/proc/self/fd")
+	if err != nil {
+		t.Skipf("cannot count the open file descriptors: %v", err)
+	}
+	return len(fds)
+}
+
+func TestProbesCloseTheirConnections(t *testing.T) {
+	server := httptest.NewTLSServer(http.NotFoundHandler())
+	server.Config.ErrorLog = stdlog.New(ioutil.Discard, "", 0) /* the probes send a ping, not HTTP */
+	defer server.Close()
+
+	/* the first probe opens the long-lived descriptors of the runtime, e.g. the poller */
+	probeTestAddress(server.Listener.Addr().String())
+	before := openFDs(t)
+
+	const probes = 200
+	for i := 0; i < probes; i++ {
+		if result := probeTestAddress(server.Listener.Addr().String()); !result.Success {
+			t.Fatalf("probe %d failed: %v", i, result.Error)
+		}
+	}
+
+	/* the server closes its side of the connections asynchronously */
+	deadline := time.Now().Add(5 * time.Second)
+	for openFDs(t) > before+5 {
+		if time.Now().After(deadline) {
+			t.Fatalf("%d file descriptors open after %d probes, %d before", openFDs(t), probes, before)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
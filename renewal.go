@@ -0,0 +1,45 @@
+package main
+
+import (
+	"crypto/x509"
+	"time"
+)
+
+type observedLeaf struct {
+	fingerprint string
+	notAfter    time.Time
+}
+
+// renewalTracker remembers the leaf certificates presented by each target during the last `window` scans.
+// While a certificate gets renewed a server may present the old and the new one in turn, so a target that
+// presented different leaves within the window, the one expiring first within the expiry threshold,
+// is considered in the middle of a renewal rather than expiring.
+type renewalTracker struct {
+	window int
+	leaves map[string][]observedLeaf
+}
+
+func newRenewalTracker(window int) *renewalTracker {
+	return &renewalTracker{window: window, leaves: make(map[string][]observedLeaf)}
+}
+
+// observe records the leaf presented by the latest probe of the target and reports whether a renewal is in progress
+func (r *renewalTracker) observe(key string, leaf *x509.Certificate, threshold time.Duration) bool {
+	leaves := append(r.leaves[key], observedLeaf{fingerprint: fingerprint(leaf), notAfter: leaf.NotAfter})
+	if len(leaves) > r.window {
+		leaves = leaves[len(leaves)-r.window:]
+	}
+	r.leaves[key] = leaves
+
+	soonest := leaves[0]
+	distinct := false
+	for _, l := range leaves[1:] {
+		if l.fingerprint != leaves[0].fingerprint {
+			distinct = true
+		}
+		if l.notAfter.Before(soonest.notAfter) {
+			soonest = l
+		}
+	}
+	return distinct && time.Until(soonest.notAfter) < threshold
+}
@@ -0,0 +1,114 @@
+package main
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"encoding/pem"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// reportCert describes a certificate presented by a target
+type reportCert struct {
+	Subject        string    `json:"subject"`
+	Issuer         string    `json:"issuer"`
+	SerialNumber   string    `json:"serialNumber"`
+	NotBefore      time.Time `json:"notBefore"`
+	NotAfter       time.Time `json:"notAfter"`
+	DNSNames       []string  `json:"dnsNames,omitempty"`
+	SpiffeIDs      []string  `json:"spiffeIds,omitempty"`      /* the spiffe:// URI SANs */
+	SubjectKeyID   string    `json:"subjectKeyId,omitempty"`   /* hex */
+	AuthorityKeyID string    `json:"authorityKeyId,omitempty"` /* hex, the subject key id of the issuer */
+	PEM            string    `json:"pem,omitempty"`
+}
+
+// reportTarget is the outcome of the probe of a target as exposed in the report
+type reportTarget struct {
+	Namespace string       `json:"namespace"`
+	Service   string       `json:"service"`
+	TargetID  string       `json:"targetID"` /* target_id label of the metrics with -hashed-target-id */
+	Port      int32        `json:"port"`
+	Address   string       `json:"address"`
+	IPFamily  string       `json:"ipFamily,omitempty"` /* only with -ip-family both */
+	Secret    bool         `json:"secret,omitempty"`   /* read from the TLS secret named Service */
+	Success   bool         `json:"success"`
+	Error     string       `json:"error,omitempty"`
+	Reason    string       `json:"reason,omitempty"` /* short reason of the failure, as in the metrics */
+	Banner    string       `json:"banner,omitempty"` /* only with -read-banner */
+	Certs     []reportCert `json:"certs,omitempty"`
+}
+
+// scanReport is the JSON report of a scan served at /certs
+type scanReport struct {
+	Timestamp time.Time      `json:"timestamp"`
+	Targets   []reportTarget `json:"targets"`
+}
+
+var latestReport struct {
+	sync.RWMutex
+	report *scanReport
+}
+
+func newScanReport(results []ProbeResult, includePEM bool) *scanReport {
+	report := &scanReport{Timestamp: time.Now(), Targets: make([]reportTarget, 0, len(results))}
+
+	for _, result := range results {
+		target := reportTarget{
+			Namespace: result.Namespace,
+			Service:   result.Service,
+			TargetID:  targetID(result.Namespace, result.Service),
+			Port:      result.Port,
+			Address:   result.Address,
+			IPFamily:  result.IPFamily,
+			Secret:    result.Secret,
+			Success:   result.Success,
+			Banner:    result.Banner,
+		}
+		if result.Error != nil {
+			target.Error = result.Error.Error()
+			target.Reason, _ = failureReason(result.Error)
+		}
+
+		for _, cert := range result.Certs {
+			c := reportCert{
+				Subject:        cert.Subject.String(),
+				Issuer:         cert.Issuer.String(),
+				SerialNumber:   cert.SerialNumber.String(),
+				NotBefore:      cert.NotBefore,
+				NotAfter:       cert.NotAfter,
+				DNSNames:       cert.DNSNames,
+				SpiffeIDs:      spiffeIDs(cert),
+				SubjectKeyID:   hex.EncodeToString(cert.SubjectKeyId),
+				AuthorityKeyID: hex.EncodeToString(cert.AuthorityKeyId),
+			}
+			if includePEM {
+				c.PEM = string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: cert.Raw}))
+			}
+			target.Certs = append(target.Certs, c)
+		}
+
+		report.Targets = append(report.Targets, target)
+	}
+
+	return report
+}
+
+func publishReport(report *scanReport) {
+	latestReport.Lock()
+	defer latestReport.Unlock()
+	latestReport.report = report
+}
+
+func reportHandler(w http.ResponseWriter, r *http.Request) {
+	latestReport.RLock()
+	defer latestReport.RUnlock()
+
+	if latestReport.report == nil {
+		http.Error(w, "No scan completed yet", http.StatusServiceUnavailable)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(latestReport.report)
+}
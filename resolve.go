@@ -0,0 +1,148 @@
+package main
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"net"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	log "github.com/sirupsen/logrus"
+)
+
+var (
+	dnsInflightGauge = promauto.NewGauge(prometheus.GaugeOpts{
+		Name: "tls_verifier_dns_inflight",
+		Help: "How many DNS resolutions of the probes are in flight",
+	})
+
+	/* bounds the concurrent DNS resolutions, nil means no bound */
+	dnsSlots chan struct{}
+)
+
+// setMaxDNSConcurrency bounds the concurrent DNS resolutions, 0 means no bound
+func setMaxDNSConcurrency(n int) {
+	if n > 0 {
+		dnsSlots = make(chan struct{}, n)
+	}
+}
+
+// lookupHost resolves the host name, waiting for a free slot when the concurrent resolutions are bounded.
+// The wait counts against the deadline of the context
+func lookupHost(ctx context.Context, host string) ([]string, error) {
+	if dnsSlots != nil {
+		select {
+		case dnsSlots <- struct{}{}:
+			defer func() { <-dnsSlots }()
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+
+	dnsInflightGauge.Inc()
+	defer dnsInflightGauge.Dec()
+	return net.DefaultResolver.LookupHost(ctx, host)
+}
+
+// dialTLS connects to the address and runs the TLS handshake like tls.DialWithDialer, but resolves the host name
+// through lookupHost, so that the resolution is bounded by -max-dns-concurrency wherever the probes run concurrently,
+// e.g. the handshakes of a burst. The resolved addresses of the family of the network are tried in order until one
+// accepts the connection, the resolution and the connections share the timeout of the dialer
+func dialTLS(dialer *net.Dialer, network string, address string, config *tls.Config) (*tls.Conn, error) {
+	host, port, err := net.SplitHostPort(address)
+	if err != nil || net.ParseIP(host) != nil {
+		return tls.DialWithDialer(dialer, network, address, config)
+	}
+
+	ctx := context.Background()
+	if dialer.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, dialer.Timeout)
+		defer cancel()
+		d := *dialer
+		d.Deadline = time.Now().Add(dialer.Timeout)
+		dialer = &d
+	}
+
+	addrs, err := lookupHost(ctx, host)
+	if err != nil {
+		return nil, &net.OpError{Op: "dial", Net: network, Err: err}
+	}
+
+	var firstErr error
+	for _, addr := range addrs {
+		family := addressFamily(addr)
+		if (network == "tcp4" && family != "ipv4") || (network == "tcp6" && family != "ipv6") {
+			continue
+		}
+
+		conn, err := tls.DialWithDialer(dialer, network, net.JoinHostPort(addr, port), config)
+		if err == nil {
+			return conn, nil
+		}
+		if firstErr == nil {
+			firstErr = err
+		}
+		/* the next address is tried only when the connection could not be opened, not when the handshake failed */
+		var opErr *net.OpError
+		if !errors.As(err, &opErr) || opErr.Op != "dial" {
+			return nil, err
+		}
+	}
+
+	if firstErr == nil {
+		firstErr = &net.OpError{Op: "dial", Net: network, Err: &net.AddrError{Err: "no suitable address found", Addr: host}}
+	}
+	return nil, firstErr
+}
+
+// probeResolved resolves the host name of the service and probes every returned address,
+// in a stable order, presenting the host name as SNI. With -ip-family ipv4 or ipv6 the addresses of the other family are skipped
+func probeResolved(opts probeOptions, target scanTarget) []ProbeResult {
+	hostname := target.hostname()
+	port := strconv.Itoa(int(target.port))
+
+	ctx, cancel := context.WithTimeout(context.Background(), opts.timeout)
+	addrs, err := lookupHost(ctx, hostname)
+	cancel()
+	if err != nil {
+		log.Errorf("Could not resolve %s: %v", hostname, err)
+		return []ProbeResult{{
+			Namespace: target.namespace,
+			Service:   target.service,
+			Port:      target.port,
+			Address:   net.JoinHostPort(hostname, port),
+			Error:     err,
+			External:  target.external,
+		}}
+	}
+
+	sort.Strings(addrs)
+	results := make([]ProbeResult, 0, len(addrs))
+	for _, addr := range addrs {
+		family := addressFamily(addr)
+		if opts.ipFamily == "ipv4" || opts.ipFamily == "ipv6" {
+			if family != opts.ipFamily {
+				continue
+			}
+		}
+
+		result := ProbeResult{
+			Namespace: target.namespace,
+			Service:   target.service,
+			Port:      target.port,
+			Address:   net.JoinHostPort(addr, port),
+			IP:        addr,
+			External:  target.external,
+		}
+		if opts.ipFamily == "both" {
+			result.IPFamily = family
+		}
+		results = append(results, probeAddress(opts, result, hostname))
+	}
+	return results
+}
@@ -0,0 +1,50 @@
+package main
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestLookupHostWaitsForASlot(t *testing.T) {
+	setMaxDNSConcurrency(1)
+	defer func() { dnsSlots = nil }()
+
+	dnsSlots <- struct{}{} /* a resolution in flight */
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	if _, err := lookupHost(ctx, "localhost"); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("lookupHost() = %v while no slot is free, expected the deadline to be exceeded", err)
+	}
+
+	<-dnsSlots
+	if _, err := lookupHost(context.Background(), "localhost"); err != nil {
+		t.Fatalf("lookupHost() failed with a free slot: %v", err)
+	}
+}
+
+func TestDialTLSResolvesTheHostName(t *testing.T) {
+	server := httptest.NewTLSServer(http.NotFoundHandler())
+	defer server.Close()
+	_, port, _ := net.SplitHostPort(server.Listener.Addr().String())
+
+	setMaxDNSConcurrency(1)
+	defer func() { dnsSlots = nil }()
+
+	for _, network := range []string{"tcp", "tcp4"} {
+		conn, err := dialTLS(&net.Dialer{Timeout: time.Second}, network, net.JoinHostPort("localhost", port), &tls.Config{InsecureSkipVerify: true})
+		if err != nil {
+			t.Fatalf("dialTLS(%s) failed: %v", network, err)
+		}
+		conn.Close()
+	}
+
+	if len(dnsSlots) != 0 {
+		t.Fatalf("%d DNS slots still taken after the dials", len(dnsSlots))
+	}
+}
@@ -0,0 +1,96 @@
+package main
+
+import (
+	"crypto/x509"
+	"strconv"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+var (
+	/* a vector without labels, so that it can be dropped when no certificate qualifies */
+	soonestExpiryGauge = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "tls_verifier_soonest_expiry_seconds",
+		Help: "Seconds to expiration of the certificate expiring first across all the services",
+	}, nil)
+	soonestExpiryInfo           *prometheus.GaugeVec /* registered by registerTargetMetrics */
+	namespaceNearestExpiryGauge = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "tls_verifier_namespace_nearest_expiry_seconds",
+		Help: "Seconds to expiration of the certificate expiring first across the services of the namespace",
+	}, []string{"namespace"})
+)
+
+type soonestCert struct {
+	result      ProbeResult
+	cert        *x509.Certificate
+	fingerprint string
+}
+
+// nearestExpiryPerNamespace returns the soonest expiration among the certificates of each namespace,
+// leaving out the ones of the ignored issuers like the per-certificate gauges do
+func nearestExpiryPerNamespace(results []ProbeResult, ignore issuerSet) map[string]time.Time {
+	nearest := make(map[string]time.Time)
+	for _, result := range results {
+		if result.Namespace == "" {
+			continue /* the targets of the targets file belong to no namespace */
+		}
+		for _, cert := range result.Certs {
+			if ignore.matches(cert) {
+				continue
+			}
+			if expiry, found := nearest[result.Namespace]; !found || cert.NotAfter.Before(expiry) {
+				nearest[result.Namespace] = cert.NotAfter
+			}
+		}
+	}
+	return nearest
+}
+
+// updateNamespaceNearestExpiry exports the soonest expiration of every namespace,
+// the namespaces without certificates in the results are dropped
+func updateNamespaceNearestExpiry(results []ProbeResult, ignore issuerSet) {
+	namespaceNearestExpiryGauge.Reset()
+	for namespace, expiry := range nearestExpiryPerNamespace(results, ignore) {
+		namespaceNearestExpiryGauge.WithLabelValues(namespace).Set(time.Until(expiry).Seconds())
+	}
+}
+
+// findSoonest returns the certificate expiring first among the results, leaving out the ones of the ignored issuers.
+// Ties are broken by the smallest fingerprint so that the choice is deterministic
+func findSoonest(results []ProbeResult, ignore issuerSet) (soonestCert, bool) {
+	var soonest soonestCert
+	found := false
+
+	for _, result := range results {
+		for _, cert := range result.Certs {
+			if ignore.matches(cert) {
+				continue
+			}
+			fp := fingerprint(cert)
+			if !found || cert.NotAfter.Before(soonest.cert.NotAfter) ||
+				(cert.NotAfter.Equal(soonest.cert.NotAfter) && fp < soonest.fingerprint) {
+				soonest = soonestCert{result: result, cert: cert, fingerprint: fp}
+				found = true
+			}
+		}
+	}
+	return soonest, found
+}
+
+// updateSoonestExpiry exports the certificate expiring first across the results of a scan,
+// both metrics are dropped when no certificate qualifies
+func updateSoonestExpiry(series *seriesGuard, results []ProbeResult, ignore issuerSet) {
+	soonestExpiryGauge.Reset()
+	soonestExpiryInfo.Reset()
+
+	soonest, found := findSoonest(results, ignore)
+	if !found {
+		return
+	}
+
+	soonestExpiryGauge.WithLabelValues().Set(time.Until(soonest.cert.NotAfter).Seconds())
+	series.set(soonestExpiryInfo, identityLabelValues(soonest.result.Namespace, soonest.result.Service, strconv.Itoa(int(soonest.result.Port)),
+		soonest.cert.SerialNumber.String(), soonest.fingerprint), 1)
+}
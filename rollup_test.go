@@ -0,0 +1,55 @@
+package main
+
+import (
+	"crypto/x509"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func TestSoonestExpiryIgnoredIssuers(t *testing.T) {
+	if err := registerTargetMetrics(prometheus.NewRegistry(), nil); err != nil {
+		t.Fatal(err)
+	}
+
+	rootKey, interKey, leafKey := newTestKey(t), newTestKey(t), newTestKey(t)
+	root := issueTestCert(t, caTemplate("noisy-root"), rootKey, nil, nil)
+	/* the intermediate of the noisy CA expires before the leaf it issued */
+	interTemplate := caTemplate("intermediate")
+	interTemplate.NotBefore, interTemplate.NotAfter = time.Now().Add(-time.Hour), time.Now().Add(time.Hour)
+	intermediate := issueTestCert(t, interTemplate, interKey, root, rootKey)
+	leaf := issueTestCert(t, leafTemplate("leaf"), leafKey, intermediate, interKey)
+
+	results := []ProbeResult{{Namespace: "ns", Service: "svc", Port: 443, Success: true, Certs: []*x509.Certificate{leaf, intermediate}}}
+
+	soonest, found := findSoonest(results, nil)
+	if !found || soonest.cert != intermediate {
+		t.Fatalf("findSoonest() without ignored issuers did not pick the intermediate")
+	}
+
+	/* only the intermediate is issued by the ignored CA, the leaf is still reported */
+	soonest, found = findSoonest(results, parseIssuers("noisy-root"))
+	if !found || soonest.cert != leaf {
+		t.Fatalf("findSoonest() did not leave out the certificate of the ignored issuer")
+	}
+
+	series := newSeriesGuard(0)
+	updateSoonestExpiry(series, results, parseIssuers("noisy-root"))
+	if n := testutil.CollectAndCount(soonestExpiryGauge); n != 1 {
+		t.Fatalf("%d soonest expiry series exported, expected 1", n)
+	}
+	if v := testutil.ToFloat64(soonestExpiryGauge); v < time.Hour.Seconds() {
+		t.Errorf("soonest expiry = %vs, the expiry of the ignored intermediate", v)
+	}
+
+	/* nothing left once the issuer of the leaf is ignored too: the previous values are dropped */
+	updateSoonestExpiry(series, results, parseIssuers("noisy-root,intermediate"))
+	if n := testutil.CollectAndCount(soonestExpiryGauge); n != 0 {
+		t.Errorf("%d soonest expiry series still exported, expected none", n)
+	}
+	if n := testutil.CollectAndCount(soonestExpiryInfo); n != 0 {
+		t.Errorf("%d soonest expiry info series still exported, expected none", n)
+	}
+}
@@ -0,0 +1,115 @@
+package main
+
+import (
+	"context"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"regexp"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// listSecretTargets returns a target for every TLS secret of the namespaces that are not skipped,
+// holding the PEM of its certificate chain
+func listSecretTargets(clientset *kubernetes.Clientset, skip *regexp.Regexp) ([]scanTarget, error) {
+	secrets, err := clientset.CoreV1().Secrets("").List(context.TODO(), metav1.ListOptions{
+		FieldSelector: "type=" + string(corev1.SecretTypeTLS),
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	var targets []scanTarget
+	for _, secret := range secrets.Items {
+		if skip != nil && skip.MatchString(secret.GetNamespace()) {
+			continue
+		}
+		targets = append(targets, scanTarget{
+			namespace: secret.GetNamespace(),
+			service:   secret.GetName(),
+			secretPEM: secret.Data[corev1.TLSCertKey],
+			labels:    map[string]string{"source": "secret"},
+		})
+	}
+	return targets, nil
+}
+
+// parseSecret turns the certificate chain of a secret target into a result, as if it was presented by a server
+func parseSecret(opts probeOptions, target scanTarget) ProbeResult {
+	result := ProbeResult{Namespace: target.namespace, Service: target.service, Secret: true}
+
+	rest := target.secretPEM
+	for {
+		var block *pem.Block
+		block, rest = pem.Decode(rest)
+		if block == nil {
+			break
+		}
+		if block.Type != "CERTIFICATE" {
+			continue
+		}
+		cert, err := x509.ParseCertificate(block.Bytes)
+		if err != nil {
+			result.Error = err
+			return result
+		}
+		result.Certs = append(result.Certs, cert)
+	}
+	certsParsedCounter.Add(float64(len(result.Certs)))
+
+	if len(result.Certs) == 0 {
+		result.Error = errors.New("no certificate found in " + corev1.TLSCertKey)
+		return result
+	}
+	result.Success = true
+
+	if opts.verifyChain {
+		if chains, err := verifyChain(result.Certs, opts.roots); err != nil {
+			result.ChainError = err
+		} else {
+			result.ChainValid = true
+			result.ChainPaths = len(chains)
+		}
+	}
+	return result
+}
+
+/* annotation of a service naming the TLS secret, in the namespace of the service, its certificate comes from */
+const tlsSecretAnnotation = "verify-k8s-certs/tls-secret"
+
+// secretLeaves fetches the leaf certificates of the secrets referenced by the services, once per scan
+type secretLeaves struct {
+	clientset *kubernetes.Clientset
+	leaves    map[string]*x509.Certificate /* nil when the secret could not be read */
+}
+
+func newSecretLeaves(clientset *kubernetes.Clientset) *secretLeaves {
+	return &secretLeaves{clientset: clientset, leaves: make(map[string]*x509.Certificate)}
+}
+
+// get returns the leaf certificate of the secret, nil when it cannot be read
+func (s *secretLeaves) get(namespace string, name string) *x509.Certificate {
+	key := namespace + "/" + name
+	if leaf, found := s.leaves[key]; found {
+		return leaf
+	}
+
+	secret, err := s.clientset.CoreV1().Secrets(namespace).Get(context.TODO(), name, metav1.GetOptions{})
+	if err != nil {
+		log.Errorf("Could not read the secret %s: %v", key, err)
+		s.leaves[key] = nil
+		return nil
+	}
+
+	result := parseSecret(probeOptions{}, scanTarget{namespace: namespace, service: name, secretPEM: secret.Data[corev1.TLSCertKey]})
+	if !result.Success {
+		log.Errorf("Could not parse the certificate of the secret %s: %v", key, result.Error)
+	}
+	s.leaves[key] = result.Leaf()
+	return s.leaves[key]
+}
@@ -0,0 +1,85 @@
+package main
+
+import (
+	"strings"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// seriesKey identifies a series of a per-target gauge or counter
+type seriesKey struct {
+	vec    prometheus.Collector /* a *prometheus.GaugeVec or a *prometheus.CounterVec */
+	labels string
+}
+
+type emittedSeries struct {
+	vec    *prometheus.GaugeVec
+	labels []string
+	value  float64
+}
+
+// seriesGuard emits the per-target gauges and counters of a scan. It bounds how many label combinations get
+// emitted (-max-series) and remembers the emitted gauge values so that the gauges can be rebuilt.
+type seriesGuard struct {
+	max     int
+	seen    map[seriesKey]bool
+	dropped int
+	emitted map[seriesKey]emittedSeries
+}
+
+func newSeriesGuard(max int) *seriesGuard {
+	return &seriesGuard{max: max, seen: make(map[seriesKey]bool), emitted: make(map[seriesKey]emittedSeries)}
+}
+
+// allow reports whether the series can be emitted
+func (g *seriesGuard) allow(key seriesKey) bool {
+	if g.max <= 0 || g.seen[key] {
+		return true
+	}
+	if len(g.seen) >= g.max {
+		g.dropped++
+		seriesCappedCounter.Inc()
+		return false
+	}
+	g.seen[key] = true
+	return true
+}
+
+// set emits the series of vec with the given label values, unless the limit was reached
+func (g *seriesGuard) set(vec *prometheus.GaugeVec, labels []string, value float64) {
+	key := seriesKey{vec: vec, labels: strings.Join(labels, "\xff")}
+	if !g.allow(key) {
+		return
+	}
+	vec.WithLabelValues(labels...).Set(value)
+	g.emitted[key] = emittedSeries{vec: vec, labels: labels, value: value}
+}
+
+// counter returns the series of vec with the given label values to be incremented, false when the limit was reached
+func (g *seriesGuard) counter(vec *prometheus.CounterVec, labels []string) (prometheus.Counter, bool) {
+	if !g.allow(seriesKey{vec: vec, labels: strings.Join(labels, "\xff")}) {
+		return nil, false
+	}
+	return vec.WithLabelValues(labels...), true
+}
+
+// setMin emits the series like set, keeping the lowest value when the series was already emitted during the scan,
+// e.g. when the certificates of several ports collapse into the same series
+func (g *seriesGuard) setMin(vec *prometheus.GaugeVec, labels []string, value float64) {
+	key := seriesKey{vec: vec, labels: strings.Join(labels, "\xff")}
+	if s, found := g.emitted[key]; found && s.value <= value {
+		return
+	}
+	g.set(vec, labels, value)
+}
+
+// rebuild resets the given gauges and sets again the values emitted during the scan,
+// dropping every series the scan did not emit
+func (g *seriesGuard) rebuild(vecs ...*prometheus.GaugeVec) {
+	for _, vec := range vecs {
+		vec.Reset()
+	}
+	for _, s := range g.emitted {
+		s.vec.WithLabelValues(s.labels...).Set(s.value)
+	}
+}
@@ -0,0 +1,45 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func TestSeriesGuardBoundsGaugesAndCounters(t *testing.T) {
+	gauge := prometheus.NewGaugeVec(prometheus.GaugeOpts{Name: "test_gauge"}, []string{"target"})
+	counter := prometheus.NewCounterVec(prometheus.CounterOpts{Name: "test_total"}, []string{"target"})
+
+	series := newSeriesGuard(2)
+	series.set(gauge, []string{"a"}, 1)
+	if c, ok := series.counter(counter, []string{"a"}); !ok {
+		t.Fatal("the second series was refused below the limit")
+	} else {
+		c.Inc()
+	}
+	if _, ok := series.counter(counter, []string{"b"}); ok {
+		t.Error("a counter series was allowed beyond the limit")
+	}
+	series.set(gauge, []string{"b"}, 1)
+
+	/* the series already emitted during the scan are still allowed */
+	if c, ok := series.counter(counter, []string{"a"}); !ok {
+		t.Error("an already emitted counter series was refused")
+	} else {
+		c.Inc()
+	}
+
+	if n := testutil.CollectAndCount(gauge); n != 1 {
+		t.Errorf("%d gauge series emitted, expected 1", n)
+	}
+	if n := testutil.CollectAndCount(counter); n != 1 {
+		t.Errorf("%d counter series emitted, expected 1", n)
+	}
+	if v := testutil.ToFloat64(counter.WithLabelValues("a")); v != 2 {
+		t.Errorf("counter = %v, expected 2", v)
+	}
+	if series.dropped != 2 {
+		t.Errorf("%d series dropped, expected 2", series.dropped)
+	}
+}
@@ -0,0 +1,88 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	log "github.com/sirupsen/logrus"
+)
+
+// serveOptions configures the HTTP server of the daemon
+type serveOptions struct {
+	port              int
+	metricsPath       string
+	livezPath         string
+	healthzPath       string
+	prometheusMetrics bool /* serve the metrics on metricsPath */
+}
+
+// runModes holds what each mode of the daemon starts, so that main can be tested without a cluster
+type runModes struct {
+	once           bool
+	failOn         string
+	requireTargets bool
+
+	scan      func() scanSummary /* the scan loop, it returns only with -once */
+	reconcile func()             /* the controller loop, nil unless -controller */
+	pushOTLP  func()             /* the OTLP pusher, nil without -otlp-metrics-endpoint */
+	serve     func() error
+}
+
+// run starts the mode selected by the flags and returns the exit code of the process. With -once the scan runs
+// synchronously and its summary decides the exit code: no HTTP server, no OTLP push. Otherwise the loops run in the
+// background while serving, until the server fails
+func run(w io.Writer, m runModes) int {
+	if m.once {
+		return onceExitCode(w, m.scan(), m.failOn, m.requireTargets)
+	}
+
+	if m.pushOTLP != nil {
+		go m.pushOTLP()
+	}
+	if m.reconcile != nil {
+		go m.reconcile()
+	} else {
+		go m.scan()
+	}
+
+	err := m.serve()
+	log.Errorf("The HTTP server stopped: %v", err)
+	return 1
+}
+
+// newServeMux mounts the handlers of the metrics, the healthchecks and the report
+func newServeMux(opts serveOptions) *http.ServeMux {
+	healthcheckHandler := func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintf(w, "Mi sento bene!")
+	}
+	/* the liveness stays up on a systemic failure: restarting the verifier would not fix the certificates */
+	healthzHandler := func(w http.ResponseWriter, r *http.Request) {
+		if isSystemicFailure() {
+			http.Error(w, "Too many probes failed in the latest scan", http.StatusServiceUnavailable)
+			return
+		}
+		healthcheckHandler(w, r)
+	}
+
+	mux := http.NewServeMux()
+	if opts.prometheusMetrics {
+		/* OpenMetrics is served only to the scrapers asking for it, the text format stays the default */
+		mux.Handle(opts.metricsPath, promhttp.InstrumentMetricHandler(prometheus.DefaultRegisterer,
+			promhttp.HandlerFor(prometheus.DefaultGatherer, promhttp.HandlerOpts{EnableOpenMetrics: true})))
+	}
+	mux.HandleFunc(opts.livezPath, healthcheckHandler) /* useful for k8s healthchecks */
+	mux.HandleFunc(opts.healthzPath, healthzHandler)
+	mux.HandleFunc("/certs", reportHandler)
+	mux.HandleFunc("/history", historyHandler)
+	return mux
+}
+
+// serve exposes the metrics, the healthchecks and the report, it returns only if the server fails
+func serve(opts serveOptions) error {
+	listenAddr := fmt.Sprintf(":%d", opts.port)
+	log.Infof("Listening for metrics and healthchecks on %s", listenAddr)
+	return http.ListenAndServe(listenAddr, newServeMux(opts))
+}
@@ -0,0 +1,102 @@
+package main
+
+import (
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestRunServe(t *testing.T) {
+	scanning, pushing := make(chan struct{}), make(chan struct{})
+	modes := runModes{
+		scan: func() scanSummary {
+			close(scanning)
+			select {} /* the scan loop of the serve mode never returns */
+		},
+		pushOTLP: func() { close(pushing) },
+		serve: func() error {
+			/* the loops run in the background while serving */
+			for _, started := range []chan struct{}{scanning, pushing} {
+				select {
+				case <-started:
+				case <-time.After(5 * time.Second):
+					return errors.New("a loop was not started before serving")
+				}
+			}
+			return errors.New("stopped")
+		},
+	}
+
+	if code := run(ioutil.Discard, modes); code != 1 {
+		t.Errorf("run() = %d, expected 1 once the server stopped", code)
+	}
+	select {
+	case <-scanning:
+	default:
+		t.Error("the scan loop was not started")
+	}
+}
+
+func TestRunServeController(t *testing.T) {
+	reconciling := make(chan struct{})
+	modes := runModes{
+		scan: func() scanSummary {
+			t.Error("the scan loop was started with -controller")
+			return scanSummary{}
+		},
+		reconcile: func() { close(reconciling) },
+		serve: func() error {
+			select {
+			case <-reconciling:
+				return errors.New("stopped")
+			case <-time.After(5 * time.Second):
+				return errors.New("the controller was not started before serving")
+			}
+		},
+	}
+
+	if code := run(ioutil.Discard, modes); code != 1 {
+		t.Errorf("run() = %d, expected 1 once the server stopped", code)
+	}
+	select {
+	case <-reconciling:
+	default:
+		t.Error("the controller was not started")
+	}
+}
+
+func TestServeMuxHandlers(t *testing.T) {
+	mux := newServeMux(serveOptions{
+		metricsPath:       "/custom-metrics",
+		livezPath:         "/custom-livez",
+		healthzPath:       "/custom-healthz",
+		prometheusMetrics: true,
+	})
+
+	for _, path := range []string{"/custom-metrics", "/custom-livez", "/custom-healthz", "/certs", "/history"} {
+		rec := httptest.NewRecorder()
+		mux.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, path, nil))
+		if rec.Code == http.StatusNotFound {
+			t.Errorf("%s is not mounted", path)
+		}
+	}
+
+	rec := httptest.NewRecorder()
+	mux.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	if rec.Code != http.StatusNotFound {
+		t.Errorf("/metrics answered %d, the metrics are served on -metrics-path only", rec.Code)
+	}
+}
+
+func TestServeMuxWithoutPrometheusMetrics(t *testing.T) {
+	mux := newServeMux(serveOptions{metricsPath: "/metrics", livezPath: "/livez", healthzPath: "/healthz"})
+
+	rec := httptest.NewRecorder()
+	mux.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	if rec.Code != http.StatusNotFound {
+		t.Errorf("/metrics answered %d without -prometheus-metrics", rec.Code)
+	}
+}
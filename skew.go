@@ -0,0 +1,42 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"net"
+	"net/http"
+	"time"
+)
+
+// headRequest is sent instead of the ping when estimating the clock skew, so that HTTPS servers reply with a Date header
+func headRequest(host string) []byte {
+	return []byte(fmt.Sprintf("HEAD / HTTP/1.1\r\nHost: %s\r\nConnection: close\r\n\r\n", host))
+}
+
+// readClockSkew reads the reply to the HEAD request sent at `sent` and estimates how much the clock of the
+// server is ahead of ours, assuming the server stamped its Date halfway through the round trip.
+// The Date header has a resolution of one second, so is the estimate.
+func readClockSkew(conn net.Conn, sent time.Time, timeout time.Duration) (time.Duration, error) {
+	if err := conn.SetReadDeadline(time.Now().Add(timeout)); err != nil {
+		return 0, err
+	}
+
+	resp, err := http.ReadResponse(bufio.NewReader(conn), nil)
+	if err != nil {
+		return 0, err
+	}
+	received := time.Now()
+	resp.Body.Close()
+
+	date := resp.Header.Get("Date")
+	if date == "" {
+		return 0, fmt.Errorf("no Date header in the reply")
+	}
+	serverTime, err := http.ParseTime(date)
+	if err != nil {
+		return 0, err
+	}
+
+	local := sent.Add(received.Sub(sent) / 2)
+	return serverTime.Sub(local).Truncate(time.Second), nil
+}
@@ -0,0 +1,137 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"unicode/utf8"
+
+	"github.com/prometheus/client_golang/prometheus"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// snapshotEntry is what we remember about a probed target between two scans
+type snapshotEntry struct {
+	Namespace  string
+	Service    string
+	Port       int32
+	Success    bool
+	LeafSerial string
+}
+
+// scanSnapshot maps every target probed during a scan (namespace/service:port) to its outcome
+type scanSnapshot map[string]snapshotEntry
+
+func targetKey(namespace string, svc string, port int32) string {
+	return fmt.Sprintf("%s/%s:%d", namespace, svc, port)
+}
+
+func (s scanSnapshot) record(result ProbeResult) {
+	entry := snapshotEntry{
+		Namespace: result.Namespace,
+		Service:   result.Service,
+		Port:      result.Port,
+		Success:   result.Success,
+	}
+	if leaf := result.Leaf(); leaf != nil {
+		entry.LeafSerial = leaf.SerialNumber.String()
+	}
+	s[result.Key()] = entry
+}
+
+// scanDiff lists the targets whose certificates changed between two consecutive scans
+type scanDiff struct {
+	New         []snapshotEntry
+	Rotated     []snapshotEntry
+	Disappeared []snapshotEntry
+	Flapped     []snapshotEntry /* targets whose probe outcome changed */
+}
+
+// diff compares the previous snapshot with the current one. Targets that did not
+// present any certificate are not considered new, and a failed probe is not a rotation.
+func (s scanSnapshot) diff(current scanSnapshot) scanDiff {
+	var d scanDiff
+
+	for _, key := range sortedKeys(current) {
+		cur := current[key]
+		prev, found := s[key]
+		switch {
+		case !found && cur.LeafSerial != "":
+			d.New = append(d.New, cur)
+		case found && prev.LeafSerial != "" && cur.LeafSerial != "" && prev.LeafSerial != cur.LeafSerial:
+			d.Rotated = append(d.Rotated, cur)
+		}
+
+		if found && prev.Success != cur.Success {
+			d.Flapped = append(d.Flapped, cur)
+		}
+	}
+
+	for _, key := range sortedKeys(s) {
+		if _, found := current[key]; !found {
+			d.Disappeared = append(d.Disappeared, s[key])
+		}
+	}
+
+	return d
+}
+
+func sortedKeys(s scanSnapshot) []string {
+	keys := make([]string, 0, len(s))
+	for key := range s {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// rotationExemplar returns the exemplar labels carrying the serial of a rotated certificate, nil when they exceed
+// the exemplar limit of client_golang, which panics on longer ones. Non-conforming CAs issue serials that long
+func rotationExemplar(serial string) prometheus.Labels {
+	labels := prometheus.Labels{"serialnumber": serial}
+	if utf8.RuneCountInString("serialnumber")+utf8.RuneCountInString(serial) > prometheus.ExemplarMaxRunes {
+		return nil
+	}
+	return labels
+}
+
+// reportScanDiff logs the changes since the previous scan and counts the rotations and the flaps through the series
+// guard of the scan
+func reportScanDiff(series *seriesGuard, d scanDiff) {
+	for _, e := range d.New {
+		log.Infof("New TLS certificate discovered for %s, serial: %s", targetKey(e.Namespace, e.Service, e.Port), e.LeafSerial)
+	}
+
+	for _, e := range d.Rotated {
+		log.Infof("TLS certificate rotated for %s, new serial: %s", targetKey(e.Namespace, e.Service, e.Port), e.LeafSerial)
+		counter, ok := series.counter(certRotationsCounter, identityLabelValues(e.Namespace, e.Service, strconv.Itoa(int(e.Port))))
+		if !ok {
+			continue
+		}
+		/* the new serial is attached as exemplar, visible when scraping in the OpenMetrics format */
+		if exemplar := rotationExemplar(e.LeafSerial); exemplar != nil {
+			counter.(prometheus.ExemplarAdder).AddWithExemplar(1, exemplar)
+		} else {
+			log.Debugf("The serial of %s is too long for an exemplar, the rotation is counted without it", targetKey(e.Namespace, e.Service, e.Port))
+			counter.Inc()
+		}
+	}
+
+	for _, e := range d.Flapped {
+		if e.Success {
+			log.Infof("Probe of %s succeeds again after failing in the previous scan", targetKey(e.Namespace, e.Service, e.Port))
+		} else {
+			log.Infof("Probe of %s fails after succeeding in the previous scan", targetKey(e.Namespace, e.Service, e.Port))
+		}
+		if counter, ok := series.counter(probeFlapsCounter, identityLabelValues(e.Namespace, e.Service, strconv.Itoa(int(e.Port)))); ok {
+			counter.Inc()
+		}
+	}
+
+	for _, e := range d.Disappeared {
+		log.Infof("Service %s disappeared since the previous scan", targetKey(e.Namespace, e.Service, e.Port))
+	}
+
+	log.Infof("Changes since the previous scan: %d new, %d rotated, %d disappeared, %d flapped", len(d.New), len(d.Rotated), len(d.Disappeared), len(d.Flapped))
+}
@@ -0,0 +1,39 @@
+package main
+
+import (
+	"math/big"
+	"strings"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+func TestRotationExemplar(t *testing.T) {
+	/* a 24 octet serial, longer than RFC 5280 allows, is 58 decimal digits */
+	long := new(big.Int).SetBytes([]byte(strings.Repeat("\xff", 24))).String()
+
+	tests := []struct {
+		name   string
+		serial string
+		fits   bool
+	}{
+		{"short serial", "1234567890", true},
+		{"20 octet serial", new(big.Int).SetBytes([]byte(strings.Repeat("\x7f", 20))).String(), true},
+		{"24 octet serial", long, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			exemplar := rotationExemplar(tt.serial)
+			if (exemplar != nil) != tt.fits {
+				t.Fatalf("rotationExemplar(%q) = %v, expected an exemplar: %v", tt.serial, exemplar, tt.fits)
+			}
+			if exemplar == nil {
+				return
+			}
+
+			counter := prometheus.NewCounter(prometheus.CounterOpts{Name: "test_rotations_total", Help: "test"})
+			counter.(prometheus.ExemplarAdder).AddWithExemplar(1, exemplar)
+		})
+	}
+}
@@ -0,0 +1,14 @@
+package main
+
+import "crypto/x509"
+
+// spiffeIDs returns the SPIFFE IDs among the URI SANs of the certificate, its DNS SANs are left out
+func spiffeIDs(cert *x509.Certificate) []string {
+	var ids []string
+	for _, uri := range cert.URIs {
+		if uri.Scheme == "spiffe" {
+			ids = append(ids, uri.String())
+		}
+	}
+	return ids
+}
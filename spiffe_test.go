@@ -0,0 +1,43 @@
+package main
+
+import (
+	"crypto/x509"
+	"net/url"
+	"reflect"
+	"testing"
+)
+
+func TestSpiffeIDs(t *testing.T) {
+	mustParse := func(raw string) *url.URL {
+		u, err := url.Parse(raw)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return u
+	}
+
+	template := leafTemplate("web", "web.default.svc.cluster.local")
+	template.URIs = []*url.URL{
+		mustParse("spiffe://cluster.local/ns/default/sa/web"),
+		mustParse("https://web.example.com/"),
+		mustParse("spiffe://example.org/web"),
+	}
+	cert := issueTestCert(t, template, newTestKey(t), nil, nil)
+
+	expected := []string{"spiffe://cluster.local/ns/default/sa/web", "spiffe://example.org/web"}
+	if ids := spiffeIDs(cert); !reflect.DeepEqual(ids, expected) {
+		t.Errorf("spiffeIDs() = %v, expected %v", ids, expected)
+	}
+	if !reflect.DeepEqual(cert.DNSNames, []string{"web.default.svc.cluster.local"}) {
+		t.Errorf("the DNS SANs were not kept: %v", cert.DNSNames)
+	}
+
+	report := newScanReport([]ProbeResult{{Namespace: "default", Service: "web", Port: 443, Success: true, Certs: []*x509.Certificate{cert}}}, false)
+	if ids := report.Targets[0].Certs[0].SpiffeIDs; !reflect.DeepEqual(ids, expected) {
+		t.Errorf("the report lists the SPIFFE IDs %v, expected %v", ids, expected)
+	}
+
+	if ids := spiffeIDs(issueTestCert(t, leafTemplate("plain", "plain.example.com"), newTestKey(t), nil, nil)); ids != nil {
+		t.Errorf("spiffeIDs() = %v for a certificate without URI SANs", ids)
+	}
+}
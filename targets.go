@@ -0,0 +1,172 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+var labelNameRegex = regexp.MustCompile(`^[a-zA-Z_][a-zA-Z0-9_]*$`)
+
+/* the label names of the per-target metrics, the labels of the targets file cannot take them over */
+var reservedLabelNames = map[string]bool{
+	"namespace": true, "service": true, "target_id": true, "port": true, "issuer": true, "serialnumber": true,
+	"oid": true, "subject_key_id": true, "authority_key_id": true, "curve": true, "spiffe_id": true,
+	"owner": true, "address": true, "ip_family": true, "source": true, "path": true,
+}
+
+// parseTargetLabelKeys parses the comma separated list of -target-label-keys, the label keys of the targets file
+// exported on the per-target metrics
+func parseTargetLabelKeys(list string) ([]string, error) {
+	var keys []string
+	seen := make(map[string]bool)
+	for _, key := range strings.Split(list, ",") {
+		if key = strings.TrimSpace(key); key == "" {
+			continue
+		}
+		if !labelNameRegex.MatchString(key) || strings.HasPrefix(key, "__") {
+			return nil, fmt.Errorf("%q is not a valid Prometheus label name", key)
+		}
+		if reservedLabelNames[key] {
+			return nil, fmt.Errorf("%q is already a label of the metrics", key)
+		}
+		if !seen[key] {
+			seen[key] = true
+			keys = append(keys, key)
+		}
+	}
+	return keys, nil
+}
+
+// targetsFile holds the targets listed in the file passed with -targets-file. The file has one
+// host:port per line, optionally followed by key=value labels; empty lines and # comments are ignored.
+// It is polled for changes and reloaded without restarting the daemon.
+type targetsFile struct {
+	sync.Mutex
+	path      string
+	labelKeys map[string]bool /* the label keys exported on the metrics, the others are dropped */
+	targets   []scanTarget
+	modTime   time.Time
+	size      int64
+}
+
+// watchTargetsFile loads the targets file and reloads it every time it changes
+func watchTargetsFile(path string, interval time.Duration, labelKeys []string) (*targetsFile, error) {
+	f := &targetsFile{path: path, labelKeys: make(map[string]bool)}
+	for _, key := range labelKeys {
+		f.labelKeys[key] = true
+	}
+	if err := f.reload(); err != nil {
+		return nil, err
+	}
+
+	go func() {
+		for range time.Tick(interval) {
+			if err := f.reload(); err != nil {
+				log.Errorf("Could not reload the targets file %s, keeping the previous targets: %v", path, err)
+			}
+		}
+	}()
+
+	return f, nil
+}
+
+// reload parses the file again if it changed since the last load
+func (f *targetsFile) reload() error {
+	info, err := os.Stat(f.path)
+	if err != nil {
+		return err
+	}
+
+	f.Lock()
+	unchanged := info.ModTime().Equal(f.modTime) && info.Size() == f.size
+	f.Unlock()
+	if unchanged {
+		return nil
+	}
+
+	file, err := os.Open(f.path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	targets := parseTargets(file, f.path, f.labelKeys)
+	log.Infof("Loaded %d targets from %s", len(targets), f.path)
+
+	f.Lock()
+	defer f.Unlock()
+	f.targets = targets
+	f.modTime = info.ModTime()
+	f.size = info.Size()
+	return nil
+}
+
+// list returns the targets of the latest load
+func (f *targetsFile) list() []scanTarget {
+	f.Lock()
+	defer f.Unlock()
+	return f.targets
+}
+
+// parseTargets parses the lines of a targets file, the malformed ones are skipped with a warning.
+// The labels whose key is not in labelKeys are dropped with a warning
+func parseTargets(r io.Reader, path string, labelKeys map[string]bool) []scanTarget {
+	var targets []scanTarget
+
+	scanner := bufio.NewScanner(r)
+	for lineNumber := 1; scanner.Scan(); lineNumber++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		fields := strings.Fields(line)
+		host, port, err := net.SplitHostPort(fields[0])
+		if err != nil || host == "" {
+			log.Warnf("Skipping line %d of %s: invalid host:port %q", lineNumber, path, fields[0])
+			continue
+		}
+		portNumber, err := strconv.ParseUint(port, 10, 16)
+		if err != nil || portNumber == 0 {
+			log.Warnf("Skipping line %d of %s: invalid port %q", lineNumber, path, port)
+			continue
+		}
+
+		labels := map[string]string{"source": "file"}
+		valid := true
+		for _, field := range fields[1:] {
+			kv := strings.SplitN(field, "=", 2)
+			if len(kv) != 2 || !labelNameRegex.MatchString(kv[0]) {
+				log.Warnf("Skipping line %d of %s: invalid label %q, expected key=value with a valid label name", lineNumber, path, field)
+				valid = false
+				break
+			}
+			if !labelKeys[kv[0]] {
+				log.Warnf("Dropping the label %q of line %d of %s, its key is not listed in -target-label-keys", field, lineNumber, path)
+				continue
+			}
+			labels[kv[0]] = kv[1]
+		}
+		if !valid {
+			continue
+		}
+
+		targets = append(targets, scanTarget{service: host, host: host, port: int32(portNumber), labels: labels})
+	}
+
+	if err := scanner.Err(); err != nil {
+		log.Warnf("Could not read all the lines of %s: %v", path, err)
+	}
+
+	return targets
+}
@@ -0,0 +1,91 @@
+package main
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"math/big"
+	"testing"
+	"time"
+)
+
+var testSerial int64
+
+func newTestKey(t *testing.T) crypto.Signer {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return key
+}
+
+// caTemplate is the template of a CA certificate without path length constraint
+func caTemplate(cn string) *x509.Certificate {
+	return &x509.Certificate{
+		Subject:               pkix.Name{CommonName: cn},
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+		MaxPathLen:            -1,
+		KeyUsage:              x509.KeyUsageCertSign | x509.KeyUsageDigitalSignature,
+	}
+}
+
+// leafTemplate is the template of an end-entity certificate valid for the given DNS names
+func leafTemplate(cn string, dnsNames ...string) *x509.Certificate {
+	return &x509.Certificate{
+		Subject:               pkix.Name{CommonName: cn},
+		DNSNames:              dnsNames,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+	}
+}
+
+// issueTestCert signs the template for the public key of key with parentKey, self-signed when parent is nil.
+// The validity and the serial number are filled when missing
+func issueTestCert(t *testing.T, template *x509.Certificate, key crypto.Signer, parent *x509.Certificate, parentKey crypto.Signer) *x509.Certificate {
+	t.Helper()
+
+	if template.SerialNumber == nil {
+		testSerial++
+		template.SerialNumber = big.NewInt(testSerial)
+	}
+	if template.NotAfter.IsZero() {
+		template.NotBefore = time.Now().Add(-time.Hour)
+		template.NotAfter = time.Now().Add(24 * time.Hour)
+	}
+	if parent == nil {
+		parent, parentKey = template, key
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, template, parent, key.Public(), parentKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return cert
+}
+
+// testChain is a root, an intermediate signed by the root and a leaf signed by the intermediate
+type testChain struct {
+	root, intermediate, leaf          *x509.Certificate
+	rootKey, intermediateKey, leafKey crypto.Signer
+}
+
+func newTestChain(t *testing.T) testChain {
+	t.Helper()
+
+	var c testChain
+	c.rootKey, c.intermediateKey, c.leafKey = newTestKey(t), newTestKey(t), newTestKey(t)
+	c.root = issueTestCert(t, caTemplate("root"), c.rootKey, nil, nil)
+	c.intermediate = issueTestCert(t, caTemplate("intermediate"), c.intermediateKey, c.root, c.rootKey)
+	c.leaf = issueTestCert(t, leafTemplate("leaf", "leaf.example.com"), c.leafKey, c.intermediate, c.intermediateKey)
+	return c
+}
@@ -0,0 +1,104 @@
+package main
+
+import (
+	"crypto/tls"
+	"errors"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"syscall"
+)
+
+// tlsAlert describes a TLS alert the server may answer a handshake with
+type tlsAlert struct {
+	code        int
+	reason      string
+	explanation string
+}
+
+/* the common alerts, keyed by the description Go uses for them */
+var tlsAlerts = map[string]tlsAlert{
+	"tls: unexpected message":              {10, "unexpected-message", "the server did not expect the message, e.g. it speaks another TLS dialect"},
+	"tls: handshake failure":               {40, "handshake-failure", "the server found no acceptable parameters, usually no cipher suite in common"},
+	"tls: bad certificate":                 {42, "bad-certificate", "the server rejected the client certificate"},
+	"tls: unknown certificate authority":   {48, "unknown-ca", "the server does not trust the issuer of the client certificate"},
+	"tls: access denied":                   {49, "access-denied", "the server denied the access"},
+	"tls: error decoding message":          {50, "decode-error", "the server could not decode a message of the handshake"},
+	"tls: protocol version not supported":  {70, "protocol-version", "the server supports none of the TLS versions offered"},
+	"tls: insufficient security level":     {71, "insufficient-security", "the server requires stronger cipher suites than the ones offered"},
+	"tls: internal error":                  {80, "internal-error", "the server failed for reasons unrelated to the client"},
+	"tls: unrecognized name":               {112, "unrecognized-name", "the server does not serve the requested server name"},
+	"tls: certificate required":            {116, "certificate-required", "the server requires a client certificate"},
+	"tls: no application protocol":         {120, "no-application-protocol", "the server supports none of the application protocols offered"},
+	"tls: illegal parameter":               {47, "illegal-parameter", "the server found a parameter of the handshake out of range"},
+	"tls: unsupported certificate":         {43, "unsupported-certificate", "the server does not support the type of the client certificate"},
+	"tls: missing extension":               {109, "missing-extension", "the server requires an extension the client did not send"},
+	"tls: unsupported extension":           {110, "unsupported-extension", "the server got an extension it did not offer"},
+	"tls: inappropriate fallback":          {86, "inappropriate-fallback", "the server detected a downgrade of the TLS version"},
+	"tls: expired certificate":             {45, "certificate-expired", "the server rejected the client certificate as expired"},
+	"tls: revoked certificate":             {44, "certificate-revoked", "the server rejected the client certificate as revoked"},
+	"tls: unknown certificate":             {46, "certificate-unknown", "the server rejected the client certificate"},
+	"tls: bad certificate status response": {113, "bad-certificate-status", "the server rejected the OCSP response"},
+}
+
+// failureReason classifies the error of a failed probe into a short reason, used as metric label,
+// and a human readable explanation of it
+func failureReason(err error) (string, string) {
+	if err == nil {
+		return "", ""
+	}
+
+	var recordErr tls.RecordHeaderError
+	if errors.As(err, &recordErr) {
+		return "not-tls", "the server answered with something that is not a TLS record"
+	}
+
+	var opErr *net.OpError
+	if errors.As(err, &opErr) && opErr.Op == "remote error" {
+		if alert, found := tlsAlerts[opErr.Err.Error()]; found {
+			return alert.reason, alert.explanation
+		}
+		return "alert", "the server refused the handshake with an alert"
+	}
+
+	var dnsErr *net.DNSError
+	if errors.As(err, &dnsErr) {
+		return "dns", "the host name could not be resolved"
+	}
+	if errors.Is(err, syscall.ECONNREFUSED) {
+		return "connection-refused", "nothing listens on the port"
+	}
+	var netErr net.Error
+	if errors.As(err, &netErr) && netErr.Timeout() {
+		return "timeout", "the server did not answer within the timeout"
+	}
+	if errors.Is(err, io.EOF) || errors.Is(err, syscall.ECONNRESET) {
+		return "connection-closed", "the server closed the connection during the handshake"
+	}
+
+	/* errors detected by the client itself */
+	switch msg := err.Error(); {
+	case strings.Contains(msg, "unsupported protocol version") || strings.Contains(msg, "unsupported versions"):
+		return "protocol-version", "the server selected a TLS version not supported by the client"
+	case strings.Contains(msg, "cipher suite"):
+		return "cipher-suite", "the server selected a cipher suite not offered by the client"
+	}
+	return "other", "unclassified error"
+}
+
+// alertCode returns the code of the TLS alert the server answered with, 0 when the error is not an alert
+func alertCode(err error) int {
+	var opErr *net.OpError
+	if !errors.As(err, &opErr) || opErr.Op != "remote error" {
+		return 0
+	}
+
+	desc := opErr.Err.Error()
+	if alert, found := tlsAlerts[desc]; found {
+		return alert.code
+	}
+	/* the alerts without a description are formatted as tls: alert(code) */
+	code, _ := strconv.Atoi(strings.TrimSuffix(strings.TrimPrefix(desc, "tls: alert("), ")"))
+	return code
+}
@@ -0,0 +1,115 @@
+package main
+
+import (
+	"crypto/tls"
+	"io/ioutil"
+	stdlog "log"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+// probeTestAddress probes the address like a scan would
+func probeTestAddress(address string) ProbeResult {
+	return probeAddress(probeOptions{timeout: 2 * time.Second}, ProbeResult{Address: address}, "localhost")
+}
+
+func TestFailureReasonOfConstrainedServers(t *testing.T) {
+	tests := []struct {
+		name   string
+		config *tls.Config
+		reason string
+		alert  int
+	}{
+		{
+			name:   "no common cipher suite",
+			config: &tls.Config{MaxVersion: tls.VersionTLS12, CipherSuites: []uint16{tls.TLS_RSA_WITH_RC4_128_SHA}},
+			reason: "handshake-failure",
+			alert:  40,
+		},
+		{
+			name:   "no common version",
+			config: &tls.Config{MinVersion: tls.VersionTLS10, MaxVersion: tls.VersionTLS11},
+			reason: "protocol-version",
+			alert:  70,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := httptest.NewUnstartedServer(http.NotFoundHandler())
+			server.TLS = tt.config
+			server.Config.ErrorLog = stdlog.New(ioutil.Discard, "", 0) /* the failed handshakes are expected */
+			server.StartTLS()
+			defer server.Close()
+
+			result := probeTestAddress(server.Listener.Addr().String())
+			if result.Success {
+				t.Fatalf("the probe succeeded, expected a failure")
+			}
+			if reason, _ := failureReason(result.Error); reason != tt.reason {
+				t.Errorf("failureReason(%v) = %s, expected %s", result.Error, reason, tt.reason)
+			}
+			if code := alertCode(result.Error); code != tt.alert {
+				t.Errorf("alertCode(%v) = %d, expected %d", result.Error, code, tt.alert)
+			}
+		})
+	}
+}
+
+func TestFailureReasonOfPlaintextListener(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer listener.Close()
+
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			conn.Write([]byte("HTTP/1.1 400 Bad Request\r\nContent-Length: 0\r\n\r\n"))
+			conn.Close()
+		}
+	}()
+
+	result := probeTestAddress(listener.Addr().String())
+	if reason, _ := failureReason(result.Error); reason != "not-tls" {
+		t.Errorf("failureReason(%v) = %s, expected not-tls", result.Error, reason)
+	}
+	if code := alertCode(result.Error); code != 0 {
+		t.Errorf("alertCode(%v) = %d, expected 0", result.Error, code)
+	}
+}
+
+func TestFailureReasonOfClosedPort(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	address := listener.Addr().String()
+	listener.Close()
+
+	result := probeTestAddress(address)
+	if reason, _ := failureReason(result.Error); reason != "connection-refused" {
+		t.Errorf("failureReason(%v) = %s, expected connection-refused", result.Error, reason)
+	}
+}
+
+func TestAlertCodeWithoutDescription(t *testing.T) {
+	err := &net.OpError{Op: "remote error", Err: alertError("tls: alert(255)")}
+	if code := alertCode(err); code != 255 {
+		t.Errorf("alertCode(%v) = %d, expected 255", err, code)
+	}
+	if reason, _ := failureReason(err); reason != "alert" {
+		t.Errorf("failureReason(%v) = %s, expected alert", err, reason)
+	}
+}
+
+type alertError string
+
+func (e alertError) Error() string { return string(e) }
@@ -0,0 +1,83 @@
+package main
+
+import (
+	"crypto/tls"
+	"errors"
+	"net"
+	"strings"
+
+	"github.com/prometheus/client_golang/prometheus"
+	log "github.com/sirupsen/logrus"
+)
+
+var tlsPortRatioGauge *prometheus.GaugeVec /* registered by registerTargetMetrics */
+
+type portClass int
+
+const (
+	portUnknown   portClass = iota /* the port could not be reached or its answer is ambiguous */
+	portPlaintext                  /* the port answered with something other than TLS */
+	portTLS                        /* the port completed a handshake or answered with a TLS alert */
+)
+
+// classifyPort tells whether the probed port speaks TLS from the outcome of its probe
+func classifyPort(result ProbeResult) portClass {
+	if result.Success {
+		return portTLS
+	}
+
+	var recordErr tls.RecordHeaderError
+	if errors.As(result.Error, &recordErr) {
+		return portPlaintext
+	}
+
+	/* the handshake reached the server, which refused it with an alert */
+	var opErr *net.OpError
+	if errors.As(result.Error, &opErr) && opErr.Op == "remote error" {
+		return portTLS
+	}
+	return portUnknown
+}
+
+// tlsPortTally classifies the ports of every service probed by a scan, keyed by namespace/service
+type tlsPortTally map[string]map[int32]portClass
+
+// add records the outcome of a probe, a port probed through several addresses speaks TLS if any of them does
+func (t tlsPortTally) add(result ProbeResult) {
+	if result.Namespace == "" || result.Secret {
+		return /* the targets of the targets file and the secrets are not services */
+	}
+
+	key := result.Namespace + "/" + result.Service
+	if t[key] == nil {
+		t[key] = make(map[int32]portClass)
+	}
+	if class := classifyPort(result); class > t[key][result.Port] {
+		t[key][result.Port] = class
+	}
+}
+
+// export replaces the ratios of the previous scan with the ones of the tally
+func (t tlsPortTally) export(series *seriesGuard) {
+	tlsPortRatioGauge.Reset()
+
+	for key, ports := range t {
+		tlsPorts, classified := 0, 0
+		for port, class := range ports {
+			switch class {
+			case portTLS:
+				tlsPorts++
+				classified++
+			case portPlaintext:
+				log.Debugf("Port %d of %s does not speak TLS", port, key)
+				classified++
+			}
+		}
+		if classified == 0 {
+			continue
+		}
+
+		parts := strings.SplitN(key, "/", 2)
+		series.set(tlsPortRatioGauge, identityLabelValues(parts[0], parts[1]), float64(tlsPorts)/float64(classified))
+	}
+}
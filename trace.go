@@ -0,0 +1,101 @@
+package main
+
+import (
+	"crypto/tls"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var tlsVersionNames = map[uint16]string{
+	tls.VersionTLS10: "TLS 1.0",
+	tls.VersionTLS11: "TLS 1.1",
+	tls.VersionTLS12: "TLS 1.2",
+	tls.VersionTLS13: "TLS 1.3",
+}
+
+func tlsVersionName(version uint16) string {
+	if name, ok := tlsVersionNames[version]; ok {
+		return name
+	}
+	return fmt.Sprintf("0x%04x", version)
+}
+
+// parseTarget parses a target in the namespace/service:port form
+func parseTarget(target string) (scanTarget, error) {
+	slash := strings.Index(target, "/")
+	colon := strings.LastIndex(target, ":")
+	if slash <= 0 || colon < slash+2 {
+		return scanTarget{}, fmt.Errorf("invalid target %q, expected namespace/service:port", target)
+	}
+
+	port, err := strconv.ParseUint(target[colon+1:], 10, 16)
+	if err != nil || port == 0 {
+		return scanTarget{}, fmt.Errorf("invalid port in target %q", target)
+	}
+
+	return scanTarget{namespace: target[:slash], service: target[slash+1 : colon], port: int32(port)}, nil
+}
+
+// traceTarget probes a single target and writes a human-readable report of the handshake.
+// It returns the exit code of the program.
+func traceTarget(w io.Writer, opts probeOptions, target string) int {
+	t, err := parseTarget(target)
+	if err != nil {
+		fmt.Fprintf(w, "%v\n", err)
+		return 1
+	}
+
+	result := testTLS(opts, t.service, t.namespace, t.port)
+	printProbeResult(w, result, opts)
+
+	if !result.Success {
+		return 1
+	}
+	return 0
+}
+
+func printProbeResult(w io.Writer, result ProbeResult, opts probeOptions) {
+	fmt.Fprintf(w, "Target:    %s\n", targetKey(result.Namespace, result.Service, result.Port))
+	fmt.Fprintf(w, "Address:   %s\n", result.Address)
+	fmt.Fprintf(w, "Timeout:   %v\n", opts.timeout)
+	fmt.Fprintf(w, "Offered:   crypto/tls default versions and cipher suites, no server verification\n")
+
+	if !result.Success {
+		fmt.Fprintf(w, "Result:    FAILED\n")
+		fmt.Fprintf(w, "Error:     %v\n", result.Error)
+		fmt.Fprintf(w, "Raw error: %#v\n", result.Error)
+		return
+	}
+
+	fmt.Fprintf(w, "Result:    OK\n")
+	fmt.Fprintf(w, "Version:   %s\n", tlsVersionName(result.TLSVersion))
+	fmt.Fprintf(w, "Cipher:    %s\n", tls.CipherSuiteName(result.CipherSuite))
+	fmt.Fprintf(w, "Handshake: %v (TCP connection included)\n", result.Handshake)
+	if opts.bannerBytes > 0 {
+		fmt.Fprintf(w, "Banner:    %q\n", result.Banner)
+	}
+
+	if opts.verifyChain {
+		if result.ChainValid {
+			fmt.Fprintf(w, "Chain:     valid, %d path(s) to a trusted root\n", result.ChainPaths)
+		} else {
+			fmt.Fprintf(w, "Chain:     INVALID (%v)\n", result.ChainError)
+		}
+	}
+
+	fmt.Fprintf(w, "Presented %d certificate(s):\n", len(result.Certs))
+	for i, cert := range result.Certs {
+		fmt.Fprintf(w, "  [%d] Subject:      %s\n", i, cert.Subject)
+		fmt.Fprintf(w, "      Issuer:       %s\n", cert.Issuer)
+		fmt.Fprintf(w, "      Serial:       %s\n", cert.SerialNumber)
+		fmt.Fprintf(w, "      Not before:   %s\n", cert.NotBefore.Format(time.RFC3339))
+		fmt.Fprintf(w, "      Not after:    %s (%v left)\n", cert.NotAfter.Format(time.RFC3339), time.Until(cert.NotAfter).Round(time.Second))
+		fmt.Fprintf(w, "      DNS names:    %v\n", cert.DNSNames)
+		fmt.Fprintf(w, "      Is CA:        %v\n", cert.IsCA)
+		fmt.Fprintf(w, "      Signature:    %v\n", cert.SignatureAlgorithm)
+		fmt.Fprintf(w, "      Public key:   %v\n", cert.PublicKeyAlgorithm)
+	}
+}
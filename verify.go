@@ -1,22 +1,26 @@
 package main
 
 import (
-	"context"
+	"crypto/sha256"
 	"crypto/tls"
+	"crypto/x509"
+	"encoding/hex"
 	"flag"
 	"fmt"
+	"math/rand"
 	"net"
-	"net/http"
 	"os"
 	"regexp"
+	"sort"
 	"strconv"
+	"strings"
 	"time"
 
 	"github.com/prometheus/client_golang/prometheus"
 	"github.com/prometheus/client_golang/prometheus/promauto"
-	"github.com/prometheus/client_golang/prometheus/promhttp"
 
-	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/fields"
 	"k8s.io/client-go/kubernetes"
 	"k8s.io/client-go/rest"
 
@@ -24,10 +28,49 @@ import (
 )
 
 var (
-	expiredCertsGauge = promauto.NewGaugeVec(prometheus.GaugeOpts{
-		Name: "tls_verifier_seconds_to_expiration_tls_certificate",
-		Help: "Seconds to expiration for the TLS certificate of the service",
-	}, []string{"namespace", "service", "port", "issuer", "serialnumber"})
+	/* the per-target metrics are registered by registerTargetMetrics once the optional labels are known */
+	expiredCertsGauge          *prometheus.GaugeVec
+	chainValidGauge            *prometheus.GaugeVec
+	endpointSpreadGauge        *prometheus.GaugeVec
+	effectiveExpiryGauge       *prometheus.GaugeVec
+	expiryDaysGauge            *prometheus.GaugeVec
+	chainPathsGauge            *prometheus.GaugeVec
+	constraintsAnomalyGauge    *prometheus.GaugeVec
+	clockSkewGauge             *prometheus.GaugeVec
+	coversServiceNameGauge     *prometheus.GaugeVec
+	burstConsistentGauge       *prometheus.GaugeVec
+	renewalInProgressGauge     *prometheus.GaugeVec
+	servedMatchesSecretGauge   *prometheus.GaugeVec
+	certPolicyInfo             *prometheus.GaugeVec
+	policyMismatchGauge        *prometheus.GaugeVec
+	handshakeSLOViolationGauge *prometheus.GaugeVec
+	certKeyIDInfo              *prometheus.GaugeVec
+	certCurveInfo              *prometheus.GaugeVec
+	disallowedCurveGauge       *prometheus.GaugeVec
+	crossClusterMatchGauge     *prometheus.GaugeVec
+	certSpiffeIDInfo           *prometheus.GaugeVec
+	chainOrderInvalidGauge     *prometheus.GaugeVec
+
+	/* registered by registerTargetMetrics too, identifying the targets by target_id with -hashed-target-id */
+	certRotationsCounter *prometheus.CounterVec
+	probeFlapsCounter    *prometheus.CounterVec
+	probeFailuresCounter *prometheus.CounterVec
+
+	/* optional labels, enabled by flags, added to the per-target metrics */
+	extraTargetLabels []string
+
+	/* DNS domain of the cluster, used to build the host names of the services */
+	clusterDomain = "cluster.local"
+
+	/* treat the first presented certificate as the leaf, whatever it is */
+	leafAtIndexZero = false
+
+	/* identify the targets of the per-target metrics by a hash instead of namespace and service */
+	hashedTargetID = false
+
+	/* the expiry gauges have a port label, without it the ports of a service collapse into the same series */
+	includePortLabel = true
+
 	discoveredCertsGauge = promauto.NewGauge(prometheus.GaugeOpts{
 		Name: "tls_verifier_discovered_tls_certificates_of_services",
 		Help: "How many TLS certificates have been discovered across all the services",
@@ -36,97 +79,1010 @@ var (
 		Name: "tls_verifier_heartbeat",
 		Help: "heartbeat counter that keeps increasing if service is healthy",
 	})
+	seriesCappedCounter = promauto.NewCounter(prometheus.CounterOpts{
+		Name: "tls_verifier_series_capped_total",
+		Help: "How many series were not emitted because the -max-series limit was reached",
+	})
+	certsParsedCounter = promauto.NewCounter(prometheus.CounterOpts{
+		Name: "tls_verifier_certs_parsed_total",
+		Help: "How many certificates were parsed, presented by the targets or read from the secrets",
+	})
+	connectionsOpenedCounter = promauto.NewCounter(prometheus.CounterOpts{
+		Name: "tls_verifier_connections_opened_total",
+		Help: "How many connections were opened to probe the targets, the failed ones included",
+	})
+	connectionCloseErrorsCounter = promauto.NewCounter(prometheus.CounterOpts{
+		Name: "tls_verifier_connection_close_errors_total",
+		Help: "How many connections opened to probe the targets could not be closed cleanly",
+	})
+	skippedServicesCounter = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "tls_verifier_skipped_services_total",
+		Help: "How many services were not probed, by reason",
+	}, []string{"reason"})
+	zeroTargetsGauge = promauto.NewGauge(prometheus.GaugeOpts{
+		Name: "tls_verifier_zero_targets",
+		Help: "1 if the latest scan found no service port to probe after filtering, 0 otherwise",
+	})
 )
 
-func testTLS(tlsTimeout time.Duration, svc string, namespace string, port int32) (bool, int) {
-	fullhostname := fmt.Sprintf("%s.%s.svc.cluster.local:%d", svc, namespace, port)
+// metricRegistrar registers the gauge and counter vectors of the per-target metrics in a registry,
+// remembering the first error instead of panicking
+type metricRegistrar struct {
+	registry prometheus.Registerer
+	err      error
+}
+
+// register registers the collector, or returns the one already registered with the same name and labels,
+// so that registering the per-target metrics again does not panic. On a conflicting registration the error is
+// remembered and the returned collector, usable but not exported, is not registered
+func (r *metricRegistrar) register(collector prometheus.Collector) prometheus.Collector {
+	if err := r.registry.Register(collector); err != nil {
+		if registered, ok := err.(prometheus.AlreadyRegisteredError); ok {
+			return registered.ExistingCollector
+		}
+		if r.err == nil {
+			r.err = err
+		}
+	}
+	return collector
+}
+
+func (r *metricRegistrar) gaugeVec(opts prometheus.GaugeOpts, labelNames []string) *prometheus.GaugeVec {
+	return r.register(prometheus.NewGaugeVec(opts, labelNames)).(*prometheus.GaugeVec)
+}
+
+func (r *metricRegistrar) counterVec(opts prometheus.CounterOpts, labelNames []string) *prometheus.CounterVec {
+	return r.register(prometheus.NewCounterVec(opts, labelNames)).(*prometheus.CounterVec)
+}
+
+// registerTargetMetrics registers the per-target gauges and counters, with the given extra labels, in the registry
+// through a metricRegistrar. The package-level metrics point to the latest registration
+func registerTargetMetrics(registry prometheus.Registerer, extraLabels []string) error {
+	extraTargetLabels = extraLabels
+	r := &metricRegistrar{registry: registry}
+
+	expiryLabels := []string{"port", "issuer", "serialnumber"}
+	if !includePortLabel {
+		expiryLabels = expiryLabels[1:]
+	}
+	expiredCertsGauge = r.gaugeVec(prometheus.GaugeOpts{
+		Name: "tls_verifier_seconds_to_expiration_tls_certificate",
+		Help: "Seconds to expiration for the TLS certificate of the service",
+	}, targetLabelNames(expiryLabels...))
+	expiryDaysGauge = r.gaugeVec(prometheus.GaugeOpts{
+		Name: "tls_verifier_days_to_expiration_tls_certificate",
+		Help: "Days (fractional) to expiration for the TLS certificate of the service",
+	}, targetLabelNames(expiryLabels...))
+	chainValidGauge = r.gaugeVec(prometheus.GaugeOpts{
+		Name: "tls_verifier_chain_valid",
+		Help: "1 if the certificate chain presented by the service verifies against the trusted roots, 0 otherwise",
+	}, targetLabelNames("port"))
+	chainPathsGauge = r.gaugeVec(prometheus.GaugeOpts{
+		Name: "tls_verifier_chain_paths",
+		Help: "How many distinct paths from the certificate presented by the service to a trusted root were found, 0 if the chain is broken",
+	}, targetLabelNames("port"))
+	constraintsAnomalyGauge = r.gaugeVec(prometheus.GaugeOpts{
+		Name: "tls_verifier_cert_constraints_anomaly",
+		Help: "1 if the basic constraints of the chain presented by the service are misconfigured, 0 otherwise",
+	}, targetLabelNames("port"))
+	clockSkewGauge = r.gaugeVec(prometheus.GaugeOpts{
+		Name: "tls_verifier_estimated_clock_skew_seconds",
+		Help: "Estimated seconds the clock of the server is ahead of the clock of the verifier, from the Date header of HTTPS replies",
+	}, targetLabelNames("port"))
+	coversServiceNameGauge = r.gaugeVec(prometheus.GaugeOpts{
+		Name: "tls_verifier_cert_covers_service_name",
+		Help: "1 if the leaf certificate presented by the service is valid for the fully qualified name of the service, 0 otherwise",
+	}, targetLabelNames("port"))
+	endpointSpreadGauge = r.gaugeVec(prometheus.GaugeOpts{
+		Name: "tls_verifier_endpoint_cert_spread",
+		Help: "How many distinct leaf certificate serials are served by the ready endpoints of the service port",
+	}, targetLabelNames("port"))
+	effectiveExpiryGauge = r.gaugeVec(prometheus.GaugeOpts{
+		Name: "tls_verifier_effective_chain_expiry_seconds",
+		Help: "Seconds to expiration of the first certificate to expire in the chain presented by the service",
+	}, targetLabelNames("port"))
+	burstConsistentGauge = r.gaugeVec(prometheus.GaugeOpts{
+		Name: "tls_verifier_burst_cert_consistent",
+		Help: "1 if a burst of simultaneous handshakes to the service port all presented the same leaf certificate, 0 otherwise",
+	}, targetLabelNames("port"))
+	renewalInProgressGauge = r.gaugeVec(prometheus.GaugeOpts{
+		Name: "tls_verifier_renewal_in_progress",
+		Help: "1 if the service port presented different leaf certificates in the latest scans, one of them expiring soon, 0 otherwise",
+	}, targetLabelNames("port"))
+	servedMatchesSecretGauge = r.gaugeVec(prometheus.GaugeOpts{
+		Name: "tls_verifier_served_matches_secret",
+		Help: "1 if the service port presents the leaf certificate of the secret named by its annotation, 0 otherwise",
+	}, targetLabelNames("port"))
+	certPolicyInfo = r.gaugeVec(prometheus.GaugeOpts{
+		Name: "tls_verifier_cert_policy_info",
+		Help: "A certificate policy OID carried by the leaf certificate presented by the service port, always 1",
+	}, targetLabelNames("port", "oid"))
+	policyMismatchGauge = r.gaugeVec(prometheus.GaugeOpts{
+		Name: "tls_verifier_cert_policy_mismatch",
+		Help: "1 if the leaf certificate presented by the service port lacks a policy OID required by the config file, 0 otherwise",
+	}, targetLabelNames("port"))
+	handshakeSLOViolationGauge = r.gaugeVec(prometheus.GaugeOpts{
+		Name: "tls_verifier_handshake_slo_violation",
+		Help: "1 if the connection and the handshake with the service port took longer than -handshake-slo, 0 otherwise",
+	}, targetLabelNames("port"))
+	certKeyIDInfo = r.gaugeVec(prometheus.GaugeOpts{
+		Name: "tls_verifier_cert_key_id_info",
+		Help: "Subject and authority key identifiers (hex) of a certificate presented by the service port, always 1",
+	}, targetLabelNames("port", "serialnumber", "subject_key_id", "authority_key_id"))
+	certCurveInfo = r.gaugeVec(prometheus.GaugeOpts{
+		Name: "tls_verifier_cert_curve_info",
+		Help: "Curve of the ECDSA leaf certificate presented by the service port, always 1",
+	}, targetLabelNames("port", "curve"))
+	certSpiffeIDInfo = r.gaugeVec(prometheus.GaugeOpts{
+		Name: "tls_verifier_cert_spiffe_id",
+		Help: "A SPIFFE ID among the URI SANs of the leaf certificate presented by the service port, always 1",
+	}, targetLabelNames("port", "spiffe_id"))
+	chainOrderInvalidGauge = r.gaugeVec(prometheus.GaugeOpts{
+		Name: "tls_verifier_chain_order_invalid",
+		Help: "1 if a certificate of the chain presented by the service port is not followed by its issuer, 0 otherwise",
+	}, targetLabelNames("port"))
+	disallowedCurveGauge = r.gaugeVec(prometheus.GaugeOpts{
+		Name: "tls_verifier_cert_disallowed_curve",
+		Help: "1 if the ECDSA leaf certificate presented by the service port is on a curve not listed in -allowed-curves, 0 otherwise",
+	}, targetLabelNames("port"))
+	crossClusterMatchGauge = r.gaugeVec(prometheus.GaugeOpts{
+		Name: "tls_verifier_cross_cluster_cert_match",
+		Help: "1 if the service port presents the same leaf certificate, or one valid for the same names, in the local and in the peer cluster, 0 otherwise",
+	}, targetLabelNames("port"))
+
+	/* the metrics below identify the targets but do not carry the extra target labels */
+	certRotationsCounter = r.counterVec(prometheus.CounterOpts{
+		Name: "tls_verifier_cert_rotations_total",
+		Help: "How many times the leaf certificate serial of a service changed between two consecutive scans",
+	}, identityLabelNames("port"))
+	probeFlapsCounter = r.counterVec(prometheus.CounterOpts{
+		Name: "tls_verifier_probe_flaps_total",
+		Help: "How many times the probe of a service port changed between success and failure across two consecutive scans",
+	}, identityLabelNames("port"))
+	failureLabels := identityLabelNames("port", "reason")
+	if contains(extraTargetLabels, "owner") {
+		/* so that the failure alerts can be routed per team like the expiry ones */
+		failureLabels = append(failureLabels, "owner")
+	}
+	probeFailuresCounter = r.counterVec(prometheus.CounterOpts{
+		Name: "tls_verifier_probe_failures_total",
+		Help: "How many probes of a service port failed, by reason",
+	}, failureLabels)
+	soonestExpiryInfo = r.gaugeVec(prometheus.GaugeOpts{
+		Name: "tls_verifier_soonest_expiry_info",
+		Help: "Identifies the certificate expiring first across all the services, always 1",
+	}, identityLabelNames("port", "serialnumber", "fingerprint"))
+	tlsPortRatioGauge = r.gaugeVec(prometheus.GaugeOpts{
+		Name: "tls_verifier_service_tls_port_ratio",
+		Help: "Ratio of the ports of the service that speak TLS among the ones that could be classified in the latest scan",
+	}, identityLabelNames())
+
+	return r.err
+}
+
+// identityLabelNames returns the label names identifying the target, namespace and service or target_id with
+// -hashed-target-id, followed by the given ones
+func identityLabelNames(names ...string) []string {
+	target := []string{"namespace", "service"}
+	if hashedTargetID {
+		target = []string{"target_id"}
+	}
+	return append(target, names...)
+}
+
+// identityLabelValues returns the values of the labels of identityLabelNames
+func identityLabelValues(namespace string, service string, values ...string) []string {
+	if hashedTargetID {
+		return append([]string{targetID(namespace, service)}, values...)
+	}
+	return append([]string{namespace, service}, values...)
+}
+
+// targetLabelNames returns the label names of a per-target metric: the ones identifying the target,
+// the given ones, then the extra target labels
+func targetLabelNames(names ...string) []string {
+	return append(identityLabelNames(names...), extraTargetLabels...)
+}
+
+// targetID is a stable identifier of the service: the first 16 hex digits of the SHA-256 of namespace/service
+func targetID(namespace string, service string) string {
+	sum := sha256.Sum256([]byte(namespace + "/" + service))
+	return hex.EncodeToString(sum[:8])
+}
+
+// probeOptions configures how a single TLS endpoint gets probed
+type probeOptions struct {
+	timeout           time.Duration
+	verifyChain       bool
+	roots             *x509.CertPool /* nil means the system roots */
+	resolveAll        bool
+	estimateClockSkew bool
+	bannerBytes       int    /* read up to this many bytes sent by the server after the handshake, 0 disables */
+	ipFamily          string /* auto, ipv4, ipv6 or both */
+}
+
+// scanTarget is a service port to probe
+type scanTarget struct {
+	namespace string
+	service   string
+	port      int32
+	portName  string
+	host      string /* set for the targets of the targets file and the external addresses, probed as is */
+	external  bool
+	secretPEM []byte            /* set for the targets of the TLS secrets, parsed instead of probed */
+	labels    map[string]string /* values of the extra target labels */
+}
+
+// hostname is the host name probed for the target
+func (t scanTarget) hostname() string {
+	if t.host != "" {
+		return t.host
+	}
+	return serviceHostname(t.service, t.namespace)
+}
+
+// isService tells whether the target is a port of a service of the cluster probed through its cluster DNS name
+func (t scanTarget) isService() bool {
+	return t.host == "" && t.secretPEM == nil
+}
+
+// key identifies the target among the ones of a scan
+func (t scanTarget) key() string {
+	key := targetKey(t.namespace, t.service, t.port)
+	if t.host != "" {
+		key += "@" + t.host
+	}
+	if t.secretPEM != nil {
+		key += " (secret)"
+	}
+	return key
+}
+
+// withLabel returns a copy of the target with the extra label set
+func (t scanTarget) withLabel(name string, value string) scanTarget {
+	labels := make(map[string]string, len(t.labels)+1)
+	for k, v := range t.labels {
+		labels[k] = v
+	}
+	labels[name] = value
+	t.labels = labels
+	return t
+}
+
+// labelValues appends the values of the extra target labels to the given ones, which start with the namespace
+// and the service. With -hashed-target-id those two are replaced by the id of the target
+func (t scanTarget) labelValues(values ...string) []string {
+	values = identityLabelValues(values[0], values[1], values[2:]...)
+	for _, name := range extraTargetLabels {
+		values = append(values, t.labels[name])
+	}
+	return values
+}
+
+// failureLabelValues returns the label values of the probe failures counter, with the owner label when it is exported
+func (t scanTarget) failureLabelValues(namespace string, service string, port int32, reason string) []string {
+	values := identityLabelValues(namespace, service, strconv.Itoa(int(port)), reason)
+	if contains(extraTargetLabels, "owner") {
+		values = append(values, t.labels["owner"])
+	}
+	return values
+}
+
+// expiryLabelValues returns the label values of the expiry gauges, the port is left out with -include-port-label=false
+func (t scanTarget) expiryLabelValues(namespace string, service string, port int32, issuer string, serial string) []string {
+	if !includePortLabel {
+		return t.labelValues(namespace, service, issuer, serial)
+	}
+	return t.labelValues(namespace, service, strconv.Itoa(int(port)), issuer, serial)
+}
+
+// scanOptions configures the periodic scan of the services
+type scanOptions struct {
+	frequency                  time.Duration
+	jitter                     time.Duration /* random delay added to every sleep between two scans */
+	immediateFirstScan         bool          /* false delays the first scan by the jitter too */
+	skipNamespaceRegex         string
+	fieldSelector              string
+	listPerNamespace           bool
+	listPageSize               int64 /* 0 lists all the services with a single call */
+	discoveryConcurrency       int
+	kubeQPS                    float32
+	kubeBurst                  int
+	chainConsistencyWindow     int
+	handshakeSLO               time.Duration /* 0 disables the check */
+	keyIDMetric                bool
+	maintenance                *maintenanceWindows /* nil when there is no maintenance window */
+	matchAnnotationKey         string              /* only the services whose annotation has this key... */
+	matchAnnotationValue       string              /* ...and this value are probed */
+	newTargetGrace             time.Duration       /* the failures of the targets seen for less than this are not counted */
+	renewalWindow              int                 /* scans in which a change of leaf certificate is considered a renewal */
+	ownerLabelKey              string              /* service label whose value is exported as the owner label */
+	requireTargets             bool
+	scanTimeout                time.Duration /* 0 means no time bound */
+	adaptiveTimeout            bool
+	maxSeries                  int /* 0 means no limit */
+	reportIncludePEM           bool
+	probeEndpoints             bool
+	probePath                  string        /* internal, external or both */
+	probeCacheTTL              time.Duration /* 0 disables the cache */
+	trust                      *trustStore
+	config                     *Config
+	targetsFile                *targetsFile /* nil when no targets file is used */
+	annotateServices           bool
+	annotateMinInterval        time.Duration
+	metricsRebuildInterval     time.Duration /* 0 disables the rebuilds */
+	expiryThreshold            time.Duration /* certificates expiring sooner are reported */
+	expiryWarningsTop          int
+	burstHandshakes            int /* 0 disables the bursts */
+	scanSecrets                bool
+	compareSecrets             bool                  /* compare the served certificates with the secrets named by the services */
+	peer                       *kubernetes.Clientset /* nil when the certificates are not compared with a peer cluster */
+	unhealthyFailureRatio      float64               /* 0 disables the check */
+	ignoreIssuers              issuerSet
+	allowedCurves              curveSet /* empty allows every curve */
+	probeTerminatingNamespaces bool
+	noNetworkProbe             bool /* only the TLS secrets are scanned */
+	once                       bool
+	expiryDaysMetric           bool
+	probe                      probeOptions
+}
+
+// ProbeResult is the outcome of probing a single service port
+type ProbeResult struct {
+	Namespace string
+	Service   string
+	Port      int32
+	Address   string
+	IP        string /* the resolved address probed, only with -resolve-all */
+	IPFamily  string /* ipv4 or ipv6, only with -ip-family both */
+	External  bool   /* probed through an address exposed outside of the cluster */
+	Secret    bool   /* read from a TLS secret, Service is the name of the secret */
+	Success   bool
+	Error     error /* why the probe failed */
+	Certs     []*x509.Certificate
+
+	TLSVersion  uint16
+	CipherSuite uint16
+
+	ChainValid bool  /* only meaningful when chain verification is enabled */
+	ChainError error /* why the chain did not verify */
+	ChainPaths int   /* how many distinct paths to a trusted root were found */
+
+	ClockSkew *time.Duration /* how much the clock of the server is ahead of ours, nil when unknown */
+	Handshake time.Duration  /* time taken by the TCP connection and the TLS handshake */
+	Banner    string         /* sent by the server right after the handshake, sanitized, only with -read-banner */
+}
+
+// Key identifies the probed target, and the probed address with -resolve-all
+func (p ProbeResult) Key() string {
+	key := targetKey(p.Namespace, p.Service, p.Port)
+	if p.IP != "" {
+		key += "@" + p.IP
+	}
+	if p.IPFamily != "" && p.IP == "" {
+		key += " (" + p.IPFamily + ")"
+	}
+	if p.External {
+		key += " (external)"
+	}
+	if p.Secret {
+		key = p.Namespace + "/" + p.Service + " (secret)"
+	}
+	return key
+}
+
+// fingerprint is the hex SHA-256 of the DER encoding of the certificate
+func fingerprint(cert *x509.Certificate) string {
+	sum := sha256.Sum256(cert.Raw)
+	return hex.EncodeToString(sum[:])
+}
+
+// Leaf returns the certificate presented by the server for itself, nil if the probe failed
+func (p ProbeResult) Leaf() *x509.Certificate {
+	if len(p.Certs) == 0 {
+		return nil
+	}
+	return p.Certs[leafIndex(p.Certs)]
+}
+
+// leafIndex finds the leaf among the presented certificates: servers are supposed to present it first,
+// but some present their chain in another order, so the first end-entity (non-CA) certificate is picked.
+// The first certificate is picked when all of them are CAs, or always with -leaf-at-index-zero
+func leafIndex(certs []*x509.Certificate) int {
+	if !leafAtIndexZero {
+		for i, cert := range certs {
+			if !cert.IsCA {
+				return i
+			}
+		}
+	}
+	return 0
+}
+
+func serviceHostname(svc string, namespace string) string {
+	return fmt.Sprintf("%s.%s.svc.%s", svc, namespace, clusterDomain)
+}
+
+// probeTarget probes the service port of the target, once per resolved address with -resolve-all
+func probeTarget(opts probeOptions, target scanTarget) []ProbeResult {
+	if target.secretPEM != nil {
+		return []ProbeResult{parseSecret(opts, target)}
+	}
+	if opts.ipFamily == "both" && !opts.resolveAll {
+		return probeFamilies(opts, target)
+	}
+	if opts.resolveAll {
+		return probeResolved(opts, target)
+	}
+	if target.host != "" {
+		result := ProbeResult{
+			Namespace: target.namespace,
+			Service:   target.service,
+			Port:      target.port,
+			Address:   net.JoinHostPort(target.host, strconv.Itoa(int(target.port))),
+			External:  target.external,
+		}
+		return []ProbeResult{probeAddress(opts, result, target.host)}
+	}
+	return []ProbeResult{testTLS(opts, target.service, target.namespace, target.port)}
+}
+
+func testTLS(opts probeOptions, svc string, namespace string, port int32) ProbeResult {
+	hostname := serviceHostname(svc, namespace)
+	fullhostname := fmt.Sprintf("%s:%d", hostname, port)
+	result := ProbeResult{Namespace: namespace, Service: svc, Port: port, Address: fullhostname}
+	return probeAddress(opts, result, hostname)
+}
+
+// probeAddress runs the TLS handshake against result.Address presenting serverName as SNI
+func probeAddress(opts probeOptions, result ProbeResult, serverName string) ProbeResult {
+	fullhostname := result.Address
 
 	conf := tls.Config{
 		InsecureSkipVerify: true,
+		ServerName:         serverName,
 	}
 
 	dialer := &net.Dialer{
-		Timeout: tlsTimeout,
+		Timeout: opts.timeout,
+	}
+
+	network := dialNetwork(opts.ipFamily)
+	if result.IPFamily != "" {
+		network = dialNetwork(result.IPFamily)
 	}
 
-	conn, err := tls.DialWithDialer(dialer, "tcp", fullhostname, &conf)
+	connectionsOpenedCounter.Inc()
+	start := time.Now()
+	conn, err := dialTLS(dialer, network, fullhostname, &conf)
+	result.Handshake = time.Since(start)
 	if err != nil {
-		log.Errorf("Could not start a TLS connection to %s: %v\n", fullhostname, err)
-		return false, 0
+		result.Error = err
+		reason, explanation := failureReason(err)
+		if code := alertCode(err); code != 0 {
+			log.Errorf("Could not start a TLS connection to %s: %v (alert %d, %s: %s)\n", fullhostname, err, code, reason, explanation)
+		} else {
+			log.Errorf("Could not start a TLS connection to %s: %v (%s: %s)\n", fullhostname, err, reason, explanation)
+		}
+		return result
+	}
+
+	defer func() {
+		if err := conn.Close(); err != nil {
+			log.Debugf("Could not close the connection to %s: %v", fullhostname, err)
+			connectionCloseErrorsCounter.Inc()
+		}
+	}()
+
+	if opts.bannerBytes > 0 {
+		if banner, err := readBanner(conn, opts.bannerBytes, opts.timeout); err != nil {
+			log.Debugf("Could not read a banner from %s: %v", fullhostname, err)
+		} else {
+			log.Debugf("Banner of %s: %s", fullhostname, banner)
+			result.Banner = banner
+		}
 	}
 
-	defer conn.Close()
+	request := []byte("ping\n")
+	if opts.estimateClockSkew {
+		request = headRequest(serverName)
+	}
 
-	_, err = conn.Write([]byte("ping\n"))
+	sent := time.Now()
+	_, err = conn.Write(request)
 	if err != nil {
 		log.Errorf("Could not send data to %s: %v\n", fullhostname, err)
-		return false, 0
+		result.Error = err
+		return result
 	}
 
-	certs := conn.ConnectionState().PeerCertificates
+	state := conn.ConnectionState()
+	certs := state.PeerCertificates
+	certsParsedCounter.Add(float64(len(certs)))
 	certsExpiryDates := make([]string, 10)
-	discoveredTLScerts := 0
 	for _, cert := range certs {
-		discoveredTLScerts++
 		certsExpiryDates = append(certsExpiryDates, cert.NotAfter.Format("2006-January-02"))
-		timeToExpiration := cert.NotAfter.Sub(time.Now())
-		expiredCertsGauge.WithLabelValues(namespace, svc, strconv.Itoa(int(port)), cert.Issuer.CommonName, cert.Issuer.SerialNumber).Set(timeToExpiration.Seconds())
 	}
 
 	log.Infof("TLS connection was successful to %s. Certs expiration dates: %v\n", fullhostname, certsExpiryDates)
-	return true, discoveredTLScerts
+	result.Success = true
+	result.Certs = certs
+	result.TLSVersion = state.Version
+	result.CipherSuite = state.CipherSuite
+
+	if opts.estimateClockSkew {
+		if skew, err := readClockSkew(conn, sent, opts.timeout); err != nil {
+			log.Debugf("Could not estimate the clock skew of %s: %v", fullhostname, err)
+		} else {
+			result.ClockSkew = &skew
+		}
+	}
+
+	if opts.verifyChain {
+		if chains, err := verifyChain(certs, opts.roots); err != nil {
+			result.ChainError = err
+		} else {
+			result.ChainValid = true
+			result.ChainPaths = len(chains)
+		}
+	}
+
+	return result
+}
+
+// adaptiveTimeout shrinks the probe timeout so that the remaining targets fit in the
+// remaining scan budget: min(timeout, remaining budget / remaining targets).
+func adaptiveTimeout(timeout time.Duration, remaining time.Duration, remainingTargets int) time.Duration {
+	if share := remaining / time.Duration(remainingTargets); share < timeout {
+		return share
+	}
+	return timeout
 }
 
-func discoverServices(discoverFrequency time.Duration, tlsTimeout time.Duration, skipNamespaceRegex string) int {
+// jitterDelay returns a random delay between 0 and jitter, 0 when jitter is not positive
+func jitterDelay(rng *rand.Rand, jitter time.Duration) time.Duration {
+	if jitter <= 0 {
+		return 0
+	}
+	return time.Duration(rng.Int63n(int64(jitter)))
+}
+
+// heartbeat counts a completed scan of the serve mode, a -once run exits instead
+func heartbeat(opts scanOptions) {
+	if !opts.once {
+		hearthbeatCounter.Inc()
+	}
+}
+
+// discoverServices scans the services every opts.frequency, with opts.once it returns the summary of the first scan
+func discoverServices(opts scanOptions) scanSummary {
 
 	config, err := rest.InClusterConfig()
 	if err != nil {
 		panic(err.Error())
 	}
+	config.QPS = opts.kubeQPS
+	config.Burst = opts.kubeBurst
 
 	clientset, err := kubernetes.NewForConfig(config)
 	if err != nil {
 		panic(err.Error())
 	}
 
-	r, err := regexp.Compile(skipNamespaceRegex)
+	r, err := regexp.Compile(opts.skipNamespaceRegex)
 
-	if skipNamespaceRegex != "" && err != nil {
+	if opts.skipNamespaceRegex != "" && err != nil {
 		panic(err.Error())
 	}
 
-	for {
+	var skip *regexp.Regexp
+	if opts.skipNamespaceRegex != "" {
+		skip = r
+	}
+
+	var previous scanSnapshot
+	chains := newChainTracker(opts.chainConsistencyWindow)
+	renewals := newRenewalTracker(opts.renewalWindow)
+	grace := newGraceTracker(opts.newTargetGrace)
+	cache := newProbeCache(opts.probeCacheTTL)
+	annotator := newServiceAnnotator(clientset, opts.annotateMinInterval)
+	lastRebuild := time.Now()
+
+	rng := rand.New(rand.NewSource(time.Now().UnixNano()))
+	if !opts.immediateFirstScan && opts.jitter > 0 {
+		delay := jitterDelay(rng, opts.jitter)
+		log.Infof("Delaying the first scan by %v", delay)
+		time.Sleep(delay)
+	}
+
+	for scan := 0; ; scan++ {
+		if scan > 0 {
+			sleep := opts.frequency + jitterDelay(rng, opts.jitter)
+			log.Infof("Sleeping for %v until the next scan", sleep)
+			time.Sleep(sleep)
+		}
+
+		if opts.maintenance.active(time.Now()) {
+			log.Infof("In a maintenance window, the scan is skipped")
+			inMaintenanceGauge.Set(1)
+			if opts.once {
+				return scanSummary{Maintenance: true}
+			}
+			continue
+		}
+		inMaintenanceGauge.Set(0)
+
 		discoveredTLScertificates := 0
-		services, err := clientset.CoreV1().Services("").List(context.TODO(), metav1.ListOptions{})
-		if err != nil {
-			panic(err.Error())
+		current := make(scanSnapshot)
+		var summary scanSummary
+		var warnings expiryWarnings
+		var results []ProbeResult
+		var reported []ProbeResult /* the successful results whose leaf issuer is not ignored */
+		tlsPorts := make(tlsPortTally)
+		var services []discoveredService
+		if !opts.noNetworkProbe {
+			services, err = listServices(clientset, opts, skip)
+			if err != nil {
+				panic(err.Error())
+			}
+		}
+
+		log.Infof("Scanning for %d services for expired TLS certificates ...\n", len(services))
+
+		var namespaceLabels map[string]map[string]string
+		if opts.probe.verifyChain && opts.trust.hasSelectors() {
+			namespaceLabels, err = listNamespaceLabels(clientset)
+			if err != nil {
+				log.Errorf("Could not list the namespaces, their CA bundles selected by labels will not be used: %v", err)
+			}
 		}
 
-		log.Infof("Scanning for %d services for expired TLS certificates ...\n", len(services.Items))
+		var terminating map[string]bool
+		if !opts.probeTerminatingNamespaces && len(services) > 0 {
+			terminating, err = listTerminatingNamespaces(clientset)
+			if err != nil {
+				log.Errorf("Could not list the terminating namespaces, their services will be probed: %v", err)
+			}
+		}
 
-		for _, svc := range services.Items {
-			ports := svc.Spec.Ports
-			ns := svc.GetNamespace()
-			svcName := svc.GetName()
+		var endpoints map[string]*corev1.Endpoints
+		if opts.probeEndpoints {
+			endpoints, err = listEndpoints(clientset)
+			if err != nil {
+				log.Errorf("Could not list the endpoints, their certificates will not be compared: %v", err)
+			}
+		}
 
-			if skipNamespaceRegex != "" && r.Match([]byte(ns)) {
-				log.Infof("Skipping service:%s in namespace: %s", svcName, ns)
+		var targets []scanTarget
+		annotations := make(map[string]string)
+		secretRefs := make(map[string]string)
+		secrets := newSecretLeaves(clientset)
+		soonest := make(map[string]time.Time)
+		localLeaves := make(map[string]crossClusterLeaf)
+		for _, svc := range services {
+			ns, svcName := svc.namespace, svc.name
+
+			if terminating[ns] {
+				log.Debugf("Skipping service:%s in terminating namespace: %s", svcName, ns)
+				skippedServicesCounter.WithLabelValues("namespace-terminating").Inc()
 				continue
 			}
 
-			for _, port := range ports {
-				if ok, certsNum := testTLS(tlsTimeout, svcName, ns, port.Port); ok {
-					discoveredTLScertificates += certsNum
+			annotations[ns+"/"+svcName] = svc.expiresAt
+			if opts.compareSecrets && svc.tlsSecret != "" {
+				secretRefs[ns+"/"+svcName] = svc.tlsSecret
+			}
+
+			labels := map[string]string{"source": "service"}
+			if opts.ownerLabelKey != "" {
+				labels["owner"] = svc.owner
+			}
+
+			if opts.probePath != "external" {
+				internal := scanTarget{namespace: ns, service: svcName, labels: labels}.withLabel("path", "internal")
+				for _, port := range svc.ports {
+					t := internal
+					t.port, t.portName = port.port, port.name
+					targets = append(targets, t)
+				}
+			}
+			if opts.probePath != "internal" {
+				for _, addr := range svc.externalAddresses {
+					external := scanTarget{namespace: ns, service: svcName, host: addr, external: true, labels: labels}.withLabel("path", "external")
+					for _, port := range svc.ports {
+						t := external
+						t.port, t.portName = port.port, port.name
+						targets = append(targets, t)
+					}
+				}
+			}
+		}
+
+		if opts.targetsFile != nil && !opts.noNetworkProbe {
+			targets = append(targets, opts.targetsFile.list()...)
+		}
+
+		if opts.scanSecrets {
+			secretTargets, err := listSecretTargets(clientset, skip)
+			if err != nil {
+				log.Errorf("Could not list the TLS secrets: %v", err)
+			}
+			targets = append(targets, secretTargets...)
+		}
+
+		/* probing in a stable order makes the series dropped by -max-series deterministic */
+		sort.SliceStable(targets, func(i, j int) bool {
+			if targets[i].namespace != targets[j].namespace {
+				return targets[i].namespace < targets[j].namespace
+			}
+			if targets[i].service != targets[j].service {
+				return targets[i].service < targets[j].service
+			}
+			if targets[i].port != targets[j].port {
+				return targets[i].port < targets[j].port
+			}
+			/* the paths, the addresses and the secrets of the same service port */
+			return targets[i].key() < targets[j].key()
+		})
+		series := newSeriesGuard(opts.maxSeries)
+
+		summary.Targets = len(targets)
+		grace.update(targets)
+
+		var deadline time.Time
+		if opts.scanTimeout > 0 {
+			deadline = time.Now().Add(opts.scanTimeout)
+		}
+
+		for i, target := range targets {
+			probe := opts.probe
+			probe.roots = opts.trust.rootsFor(target.namespace, namespaceLabels[target.namespace])
+			if !deadline.IsZero() {
+				remaining := time.Until(deadline)
+				if remaining <= 0 {
+					log.Warnf("Scan timeout of %v exceeded, %d service ports were not probed", opts.scanTimeout, len(targets)-i)
+					break
+				}
+				if opts.adaptiveTimeout {
+					probe.timeout = adaptiveTimeout(probe.timeout, remaining, len(targets)-i)
+				}
+			}
+
+			ns, svcName, port := target.namespace, target.service, target.port
+			for _, result := range cache.probe(probe, target) {
+				t := target
+				if opts.probe.resolveAll {
+					t = target.withLabel("address", result.IP)
 				}
+				if opts.probe.ipFamily == "both" {
+					t = t.withLabel("ip_family", result.IPFamily)
+				}
+
+				if result.Success && opts.ignoreIssuers.matches(result.Leaf()) {
+					/* discovered but not reported, the whole chain of the leaf is ignored */
+					discoveredTLScertificates += len(result.Certs)
+					ignoredCertsCounter.Add(float64(len(result.Certs)))
+					log.Debugf("Ignoring the certificates of %s, the issuer of its leaf is ignored", result.Key())
+				} else if result.Success {
+					discoveredTLScertificates += len(result.Certs)
+					reported = append(reported, result)
+					renewing := renewals.observe(result.Key(), result.Leaf(), opts.expiryThreshold)
+					series.set(renewalInProgressGauge, t.labelValues(ns, svcName, strconv.Itoa(int(port))), boolToFloat(renewing))
+					for _, cert := range result.Certs {
+						if opts.ignoreIssuers.matches(cert) {
+							ignoredCertsCounter.Inc()
+							continue
+						}
+						if s, found := soonest[ns+"/"+svcName]; target.isService() && (!found || cert.NotAfter.Before(s)) {
+							soonest[ns+"/"+svcName] = cert.NotAfter
+						}
+						timeToExpiration := cert.NotAfter.Sub(time.Now())
+						if timeToExpiration <= 0 {
+							log.Errorf("Certificate %q of %s expired on %s", cert.Subject.CommonName, result.Key(), cert.NotAfter.Format("2006-January-02"))
+							summary.Expired++
+						} else if timeToExpiration < opts.expiryThreshold && renewing && cert == result.Leaf() {
+							log.Infof("Certificate %q of %s expires on %s, a renewal is in progress", cert.Subject.CommonName, result.Key(), cert.NotAfter.Format("2006-January-02"))
+						} else if timeToExpiration < opts.expiryThreshold {
+							warnings.add(result.Key(), cert.Subject.CommonName, cert.NotAfter)
+							summary.Expiring++
+						}
+						labels := t.expiryLabelValues(ns, svcName, port, cert.Issuer.CommonName, cert.Issuer.SerialNumber)
+						series.setMin(expiredCertsGauge, labels, timeToExpiration.Seconds())
+						if opts.expiryDaysMetric {
+							series.setMin(expiryDaysGauge, labels, timeToExpiration.Hours()/24)
+						}
+						if opts.keyIDMetric {
+							series.set(certKeyIDInfo, t.labelValues(ns, svcName, strconv.Itoa(int(port)), cert.SerialNumber.String(),
+								hex.EncodeToString(cert.SubjectKeyId), hex.EncodeToString(cert.AuthorityKeyId)), 1)
+						}
+					}
+
+					effective := effectiveExpiry(result.Certs)
+					if leaf := result.Leaf(); effective.Before(leaf.NotAfter) {
+						log.Warnf("The chain of %s expires on %s, before its leaf certificate", result.Key(), effective.Format("2006-January-02"))
+					}
+					series.set(effectiveExpiryGauge, t.labelValues(ns, svcName, strconv.Itoa(int(port))), time.Until(effective).Seconds())
+
+					anomalies := constraintAnomalies(result.Certs)
+					for _, anomaly := range anomalies {
+						log.Warnf("Basic constraints anomaly in the chain of %s: %s", result.Key(), anomaly)
+					}
+					series.set(constraintsAnomalyGauge, t.labelValues(ns, svcName, strconv.Itoa(int(port))), boolToFloat(len(anomalies) > 0))
+
+					ordered := chainOrderValid(result.Certs)
+					if !ordered {
+						log.Debugf("The chain of %s is not presented in order: %s", result.Key(), chainOrder(result.Certs))
+					}
+					series.set(chainOrderInvalidGauge, t.labelValues(ns, svcName, strconv.Itoa(int(port))), boolToFloat(!ordered))
+
+					if target.isService() {
+						expected := serviceHostname(svcName, ns)
+						covers := result.Leaf().VerifyHostname(expected) == nil
+						if !covers {
+							log.Warnf("The certificate of %s does not cover the name of the service, expected: %s, actual: %v", result.Key(), expected, result.Leaf().DNSNames)
+						}
+						series.set(coversServiceNameGauge, t.labelValues(ns, svcName, strconv.Itoa(int(port))), boolToFloat(covers))
+					}
+
+					for _, oid := range policyOIDs(result.Leaf()) {
+						series.set(certPolicyInfo, t.labelValues(ns, svcName, strconv.Itoa(int(port)), oid), 1)
+					}
+					if required := opts.config.requiredPolicyOIDs(ns, svcName); len(required) > 0 && ns != "" && !result.Secret {
+						missing := missingPolicies(result.Leaf(), required)
+						if len(missing) > 0 {
+							log.Warnf("The certificate of %s does not carry the required policies %v, it carries %v", result.Key(), missing, policyOIDs(result.Leaf()))
+						}
+						series.set(policyMismatchGauge, t.labelValues(ns, svcName, strconv.Itoa(int(port))), boolToFloat(len(missing) > 0))
+					}
+
+					for _, id := range spiffeIDs(result.Leaf()) {
+						series.set(certSpiffeIDInfo, t.labelValues(ns, svcName, strconv.Itoa(int(port)), id), 1)
+					}
+
+					if curve := curveName(result.Leaf()); curve != "" {
+						series.set(certCurveInfo, t.labelValues(ns, svcName, strconv.Itoa(int(port)), curve), 1)
+						if len(opts.allowedCurves) > 0 {
+							disallowed := !opts.allowedCurves.allows(curve)
+							if disallowed {
+								log.Warnf("The certificate of %s is on the curve %s, which is not allowed", result.Key(), curve)
+							}
+							series.set(disallowedCurveGauge, t.labelValues(ns, svcName, strconv.Itoa(int(port))), boolToFloat(disallowed))
+						}
+					}
+
+					if secret, found := secretRefs[ns+"/"+svcName]; found && target.isService() {
+						if secretLeaf := secrets.get(ns, secret); secretLeaf != nil {
+							matches := fingerprint(secretLeaf) == fingerprint(result.Leaf())
+							if !matches {
+								log.Warnf("%s serves a certificate different from the one of the secret %s, its pods probably need a reload", result.Key(), secret)
+							}
+							series.set(servedMatchesSecretGauge, t.labelValues(ns, svcName, strconv.Itoa(int(port))), boolToFloat(matches))
+						}
+					}
+
+					if opts.burstHandshakes > 0 && !result.Secret {
+						consistent, compared := probeBurst(probe, result, target.hostname(), opts.burstHandshakes)
+						labels := t.labelValues(ns, svcName, strconv.Itoa(int(port)))
+						if !compared {
+							log.Warnf("Every handshake of a burst of %d to %s failed, the consistency is unknown", opts.burstHandshakes, result.Key())
+							burstConsistentGauge.DeleteLabelValues(labels...)
+						} else {
+							if !consistent {
+								log.Warnf("A burst of %d handshakes to %s presented different leaf certificates", opts.burstHandshakes, result.Key())
+							}
+							series.set(burstConsistentGauge, labels, boolToFloat(consistent))
+						}
+					}
+
+					if opts.handshakeSLO > 0 && !result.Secret {
+						violation := result.Handshake > opts.handshakeSLO
+						if violation {
+							log.Warnf("The handshake with %s took %v, more than the SLO of %v", result.Key(), result.Handshake, opts.handshakeSLO)
+						}
+						series.set(handshakeSLOViolationGauge, t.labelValues(ns, svcName, strconv.Itoa(int(port))), boolToFloat(violation))
+					}
+
+					if result.ClockSkew != nil {
+						series.set(clockSkewGauge, t.labelValues(ns, svcName, strconv.Itoa(int(port))), result.ClockSkew.Seconds())
+					}
+				}
+				if opts.probe.verifyChain && result.Success {
+					key := result.Key()
+					if !result.ChainValid {
+						log.Warnf("Certificate chain of %s does not verify: %v", key, result.ChainError)
+					}
+					valid := chains.observe(key, result.ChainValid)
+					labels := t.labelValues(ns, svcName, strconv.Itoa(int(port)))
+					series.set(chainValidGauge, labels, boolToFloat(valid))
+					if result.ChainPaths > 1 {
+						log.Debugf("Certificate chain of %s has %d validation paths, the intermediates are probably cross-signed", key, result.ChainPaths)
+					}
+					series.set(chainPathsGauge, labels, float64(result.ChainPaths))
+				}
+				if opts.peer != nil && !result.Secret && (target.isService() || target.external) {
+					/* the internal path is preferred, the external one is compared only with -probe-path external */
+					if _, found := localLeaves[targetKey(ns, svcName, port)]; !found || !result.External {
+						localLeaves[targetKey(ns, svcName, port)] = crossClusterLeaf{target: t, leaf: result.Leaf()}
+					}
+				}
+				current.record(result)
+				tlsPorts.add(result)
+				results = append(results, result)
+				summary.Probes++
+				if !result.Success && grace.inGrace(target) {
+					log.Infof("The probe of %s failed within the grace period of the new targets, the failure is not counted", result.Key())
+				} else if !result.Success {
+					countNamespaceProbe(result)
+					reason, _ := failureReason(result.Error)
+					if counter, ok := series.counter(probeFailuresCounter, t.failureLabelValues(ns, svcName, port, reason)); ok {
+						counter.Inc()
+					}
+					summary.Failures++
+				} else {
+					countNamespaceProbe(result)
+				}
+			}
+
+			if eps, found := endpoints[ns+"/"+svcName]; found && target.isService() {
+				spread := leafSerialSpread(probeEndpoints(probe, target, eps))
+				labels := target.labelValues(ns, svcName, strconv.Itoa(int(port)))
+				if spread > 1 {
+					log.Warnf("The ready endpoints of %s serve %d distinct leaf certificates", targetKey(ns, svcName, port), spread)
+				}
+				series.set(endpointSpreadGauge, labels, float64(spread))
+			}
+		}
+
+		if opts.peer != nil {
+			peerLeaves, err := probePeer(opts.peer, opts, skip)
+			if err != nil {
+				log.Errorf("Could not list the services of the peer cluster, the certificates are not compared: %v", err)
+			} else {
+				compareClusters(series, localLeaves, peerLeaves)
 			}
+		}
+
+		zeroTargetsGauge.Set(boolToFloat(len(targets) == 0))
+		if len(targets) == 0 && opts.requireTargets {
+			log.Errorf("No service port left to probe after filtering, the skip regex is probably too aggressive")
+		}
+
+		warnings.log(opts.expiryThreshold, opts.expiryWarningsTop)
 
+		if series.dropped > 0 {
+			log.Warnf("Reached the limit of %d series, %d series were dropped", opts.maxSeries, series.dropped)
+		}
+
+		if opts.metricsRebuildInterval > 0 && time.Since(lastRebuild) >= opts.metricsRebuildInterval {
+			log.Infof("Rebuilding the per-target metrics from the latest scan")
+			series.rebuild(expiredCertsGauge, expiryDaysGauge, chainValidGauge, chainPathsGauge, constraintsAnomalyGauge, clockSkewGauge, coversServiceNameGauge, endpointSpreadGauge, effectiveExpiryGauge, burstConsistentGauge, renewalInProgressGauge, servedMatchesSecretGauge, certPolicyInfo, policyMismatchGauge, handshakeSLOViolationGauge, certKeyIDInfo, certCurveInfo, disallowedCurveGauge, crossClusterMatchGauge, certSpiffeIDInfo, chainOrderInvalidGauge)
+			lastRebuild = time.Now()
 		}
 
 		discoveredCertsGauge.Set(float64(discoveredTLScertificates))
-		hearthbeatCounter.Inc()
+		heartbeat(opts)
+		publishReport(newScanReport(results, opts.reportIncludePEM))
+		updateSystemicFailure(summary, opts.unhealthyFailureRatio)
+		updateSoonestExpiry(series, reported, opts.ignoreIssuers)
+		updateNamespaceNearestExpiry(reported, opts.ignoreIssuers)
+		tlsPorts.export(series)
+
+		if opts.annotateServices {
+			annotator.annotate(soonest, annotations)
+		}
+
+		var changes scanDiff
+		if previous != nil {
+			changes = previous.diff(current)
+			reportScanDiff(series, changes)
+			forgetNamespaces(previous, current)
+		}
+		previous = current
+		recordHistory(newHistoryEntry(summary, changes))
 
-		log.Infof("Sleeping for %v until the next scan", discoverFrequency)
-		time.Sleep(discoverFrequency)
+		if opts.once {
+			return summary
+		}
 	}
 }
 
@@ -141,8 +1097,85 @@ func main() {
 	tlsTimeout := flag.String("timeout", "400ms", "Connection timeout to TLS endpoints")
 	skipNamespaceRegex := flag.String("skip-namespace-regex", "", "Namespaces matching this regex get skipped")
 	port := flag.Int("port", 9999, "the tcp port where to listen on")
+	verifyChain := flag.Bool("verify-chain", false, "Verify the certificate chain presented by the services against the trusted roots")
+	caBundle := flag.String("ca-bundle", "", "PEM file with the roots used to verify the chains (default: system roots)")
+	chainConsistencyWindow := flag.Int("chain-consistency-window", 1, "How many consecutive probes must find a chain invalid before reporting it as invalid")
+	requireTargets := flag.Bool("require-targets", false, "Report an error when a scan finds no service port to probe after filtering")
+	scanTimeout := flag.String("scan-timeout", "0s", "Maximum duration of a scan, the service ports left are not probed (0 means no limit)")
+	adaptiveTimeout := flag.Bool("adaptive-timeout", false, "Shrink the timeout of the probes so that a scan fits in -scan-timeout")
+	traceProbe := flag.String("trace-probe", "", "Probe only this target (namespace/service:port), print a detailed report and exit")
+	ownerLabelKey := flag.String("owner-label-key", "", "Service label (e.g. team) whose value is exported as the owner label of the metrics")
+	maxSeries := flag.Int("max-series", 0, "Maximum number of per-target series, gauges and counters, emitted by a scan (0 means no limit)")
+	historySize := flag.Int("history-size", 10, fmt.Sprintf("How many scan summaries are served at /history (0 disables the history, at most %d)", maxHistorySize))
+	reportIncludePEM := flag.Bool("report-include-pem", false, "Include the PEM of every presented certificate in the /certs report")
+	probeEndpoints := flag.Bool("probe-endpoints", false, "Also probe every ready endpoint of the services and report how many distinct leaf certificates they serve")
+	ipFamily := flag.String("ip-family", "auto", "IP family of the probed addresses: auto (the one picked by the dialer), ipv4, ipv6 or both (every target is probed once per family)")
+	resolveAll := flag.Bool("resolve-all", false, "Resolve the service host names and probe every returned address")
+	probeCacheTTL := flag.String("probe-cache-ttl", "0s", "How long the results of a successful probe are reused instead of probing the target again (0 disables the cache)")
+	annotateServices := flag.Bool("annotate-services", false, "Annotate every service with the soonest expiry of its certificates")
+	annotateMinInterval := flag.String("annotate-min-interval", "1h", "Minimum interval between two annotation patches of the same service")
+	fieldSelector := flag.String("field-selector", "", "Field selector passed to the API server when listing the services (e.g. spec.type!=ExternalName)")
+	metricsRebuildInterval := flag.String("metrics-rebuild-interval", "0s", "How often the per-target metrics are reset and rebuilt from the latest scan (0 disables the rebuilds)")
+	configFile := flag.String("config", "", "Path of the YAML configuration file")
+	controller := flag.Bool("controller", false, "Reconcile the CertCheck resources instead of scanning all the services")
+	expiryDaysMetric := flag.Bool("expiry-days-metric", false, "Also export the time to expiration of the certificates in days")
+	listPageSize := flag.Int64("list-page-size", 500, "How many services are listed per call to the API server, the pages are filtered one at a time (0 lists all of them with a single call)")
+	listPerNamespace := flag.Bool("list-per-namespace", false, "List the services of every namespace separately instead of with a single cluster-wide call")
+	discoveryConcurrency := flag.Int("discovery-concurrency", 4, "How many namespaces are listed in parallel with -list-per-namespace")
+	kubeQPS := flag.Float64("kube-qps", 5, "Maximum queries per second to the Kubernetes API server")
+	kubeBurst := flag.Int("kube-burst", 10, "Maximum burst of queries to the Kubernetes API server")
+	targetsFilePath := flag.String("targets-file", "", "File with additional host:port targets to probe, one per line, reloaded when it changes")
+	expiryThreshold := flag.String("expiry-threshold", "168h", "Certificates expiring within this duration are reported as expiring soon")
+	targetLabelKeys := flag.String("target-label-keys", "", "Comma separated keys of the labels of the targets file exported on the per-target metrics, e.g. team,environment")
+	once := flag.Bool("once", false, "Run a single scan, print a summary and exit with a non-zero code on the problems selected by -fail-on")
+	failOn := flag.String("fail-on", "expiry", "What makes -once exit with a non-zero code: expiry, failures or both")
+	estimateClockSkew := flag.Bool("estimate-clock-skew", false, "Send an HTTP HEAD request after the handshake and estimate the clock skew from the Date header of the reply")
+	flag.BoolVar(&includePortLabel, "include-port-label", includePortLabel, "Label the expiry gauges with the port, without it the ports of a service collapse into the same series")
+	flag.BoolVar(&hashedTargetID, "hashed-target-id", hashedTargetID, "Label the per-target metrics with a hash of namespace and service (target_id) instead of namespace and service")
+	flag.BoolVar(&leafAtIndexZero, "leaf-at-index-zero", leafAtIndexZero, "Treat the first presented certificate as the leaf instead of the first non-CA one")
+	flag.StringVar(&clusterDomain, "cluster-domain", clusterDomain, "DNS domain of the cluster")
+	metricsPath := flag.String("metrics-path", "/metrics", "HTTP path where the metrics are served")
+	livezPath := flag.String("livez-path", "/livez", "HTTP path of the liveness healthcheck")
+	healthzPath := flag.String("healthz-path", "/healthz", "HTTP path of the healthcheck")
+	expiryWarningsTop := flag.Int("expiry-warnings-top", 10, "How many of the soonest expiring certificates are named in the warning logged after every scan")
+	probePath := flag.String("probe-path", "internal", "Probe the services through the cluster DNS (internal), their external addresses (external) or both")
+	renewalWindow := flag.Int("renewal-window", 2, "A service port that presented different leaf certificates within this many scans, one of them expiring soon, is considered in the middle of a renewal")
+	jitter := flag.String("jitter", "0s", "Random delay, up to this duration, added to every sleep between two scans")
+	immediateFirstScan := flag.Bool("immediate-first-scan", true, "Run the first scan right at startup, false delays it by a random -jitter too")
+	probeTerminatingNamespaces := flag.Bool("probe-terminating-namespaces", false, "Also probe the services of the namespaces being deleted")
+	maintenanceWindow := flag.String("maintenance-window", "", "Comma separated daily HH:MM-HH:MM ranges during which the scans are skipped (e.g. 02:00-04:00)")
+	maintenanceTimezone := flag.String("maintenance-timezone", "UTC", "Time zone of -maintenance-window, as an IANA name (e.g. Europe/Rome) or Local")
+	matchAnnotation := flag.String("match-annotation", "", "Probe only the services with this annotation, as key=value (e.g. verify-k8s-certs/campaign=q1-rotation)")
+	readBannerBytes := flag.Int("read-banner", 0, fmt.Sprintf("Read up to this many bytes sent by the server right after the handshake, e.g. an SMTP greeting, and report them (0 disables, at most %d)", maxBannerBytes))
+	keyIDMetric := flag.Bool("key-id-metric", false, "Also export the subject and authority key identifiers of every certificate")
+	handshakeSLO := flag.String("handshake-slo", "0s", "Report the service ports whose connection and handshake take longer than this (0 disables)")
+	newTargetGrace := flag.String("new-target-grace", "0s", "The failures of the targets that appeared less than this ago are logged but not counted (0 disables)")
+	maxDNSConcurrency := flag.Int("max-dns-concurrency", 0, "Maximum number of concurrent DNS resolutions of the probes (0 means no limit)")
+	unhealthyFailureRatio := flag.Float64("unhealthy-failure-ratio", 0, "Ratio of failed probes in a scan, between 0 and 1, above which the healthz endpoint fails (0 disables the check)")
+	allowedCurves := flag.String("allowed-curves", "", "Comma separated curves the ECDSA leaf certificates are allowed on, e.g. P-256,P-384 (empty allows every curve)")
+	ignoreIssuers := flag.String("ignore-issuers", "", "Comma separated issuers, by common name or organization, whose certificates are not reported")
+	peerKubeconfig := flag.String("peer-kubeconfig", "", "Kubeconfig of a peer cluster whose certificates are compared with the local ones, e.g. during a migration, its current context is used")
+	peerAPIServer := flag.String("peer-api-server", "", "URL of the API server of a peer cluster whose certificates are compared with the local ones, overrides the server of -peer-kubeconfig")
+	peerTokenFile := flag.String("peer-token-file", "", "File with the token of a service account of the peer cluster allowed to list its services")
+	peerCAFile := flag.String("peer-ca-file", "", "CA bundle trusted for the API server of the peer cluster (the system roots when empty)")
+	compareSecrets := flag.Bool("compare-secrets", false, "Compare the certificate served by the services with the one of the secret named by their "+tlsSecretAnnotation+" annotation")
+	scanSecrets := flag.Bool("scan-secrets", false, "Also read the certificates of the TLS secrets of the cluster")
+	noNetworkProbe := flag.Bool("no-network-probe", false, "Do not connect to the services, only read the TLS secrets (requires -scan-secrets)")
+	otlpMetricsEndpoint := flag.String("otlp-metrics-endpoint", "", "URL of an OTLP/HTTP metrics endpoint (e.g. http://collector:4318/v1/metrics) the core metrics are pushed to")
+	otlpPushInterval := flag.String("otlp-push-interval", "1m", "How often the metrics are pushed to -otlp-metrics-endpoint")
+	prometheusMetrics := flag.Bool("prometheus-metrics", true, "Serve the metrics to Prometheus on -metrics-path")
+	burstHandshakes := flag.Int("burst-handshakes", 0, fmt.Sprintf("Open this many simultaneous handshakes to every service port and check that they present the same certificate (0 disables, at most %d)", maxBurstHandshakes))
+	validateConfig := flag.Bool("validate-config", false, "Validate the file passed with -config and exit, without connecting to the cluster")
 	flag.Parse()
 
+	if *validateConfig {
+		if *configFile == "" {
+			fmt.Printf("-validate-config requires -config\n")
+			os.Exit(1)
+		}
+		os.Exit(validateConfigFile(os.Stdout, *configFile))
+	}
+
 	discoverFrequencyDuration, err := time.ParseDuration(*discoverFrequency)
 
 	if err != nil {
@@ -157,17 +1190,346 @@ func main() {
 		os.Exit(1)
 	}
 
-	go discoverServices(discoverFrequencyDuration, tlsTimeoutDuration, *skipNamespaceRegex)
+	scanTimeoutDuration, err := time.ParseDuration(*scanTimeout)
+
+	if err != nil {
+		fmt.Printf("Invalid specified scan timeout: %v\n", err)
+		os.Exit(1)
+	}
+
+	probeCacheTTLDuration, err := time.ParseDuration(*probeCacheTTL)
+
+	if err != nil {
+		fmt.Printf("Invalid specified probe cache TTL: %v\n", err)
+		os.Exit(1)
+	}
+
+	annotateMinIntervalDuration, err := time.ParseDuration(*annotateMinInterval)
+
+	if err != nil {
+		fmt.Printf("Invalid specified annotation interval: %v\n", err)
+		os.Exit(1)
+	}
+
+	if _, err := fields.ParseSelector(*fieldSelector); err != nil {
+		fmt.Printf("Invalid specified field selector: %v\n", err)
+		os.Exit(1)
+	}
+
+	metricsRebuildIntervalDuration, err := time.ParseDuration(*metricsRebuildInterval)
+
+	if err != nil {
+		fmt.Printf("Invalid specified metrics rebuild interval: %v\n", err)
+		os.Exit(1)
+	}
+
+	if *discoveryConcurrency < 1 {
+		fmt.Printf("Invalid specified discovery concurrency: %d, it must be at least 1\n", *discoveryConcurrency)
+		os.Exit(1)
+	}
+
+	expiryThresholdDuration, err := time.ParseDuration(*expiryThreshold)
+
+	if err != nil {
+		fmt.Printf("Invalid specified expiry threshold: %v\n", err)
+		os.Exit(1)
+	}
+
+	if *failOn != "expiry" && *failOn != "failures" && *failOn != "both" {
+		fmt.Printf("Invalid specified -fail-on: %s, it must be expiry, failures or both\n", *failOn)
+		os.Exit(1)
+	}
+
+	paths := map[string]bool{"/certs": true, "/history": true}
+	for _, path := range []string{*metricsPath, *livezPath, *healthzPath} {
+		if !strings.HasPrefix(path, "/") || paths[path] {
+			fmt.Printf("Invalid specified HTTP path: %s, it must start with / and be different from the other paths\n", path)
+			os.Exit(1)
+		}
+		paths[path] = true
+	}
+
+	if *expiryWarningsTop < 0 {
+		fmt.Printf("Invalid specified number of expiry warnings: %d, it cannot be negative\n", *expiryWarningsTop)
+		os.Exit(1)
+	}
+
+	jitterDuration, err := time.ParseDuration(*jitter)
+	if err != nil || jitterDuration < 0 {
+		fmt.Printf("Invalid specified jitter: %s\n", *jitter)
+		os.Exit(1)
+	}
+
+	otlpPushIntervalDuration, err := time.ParseDuration(*otlpPushInterval)
+	if err != nil || otlpPushIntervalDuration <= 0 {
+		fmt.Printf("Invalid specified OTLP push interval: %s\n", *otlpPushInterval)
+		os.Exit(1)
+	}
+
+	if *noNetworkProbe && !*scanSecrets {
+		fmt.Printf("Invalid specified flags: -no-network-probe requires -scan-secrets, there would be nothing to scan\n")
+		os.Exit(1)
+	}
+	if *noNetworkProbe && (*controller || *traceProbe != "") {
+		fmt.Printf("Invalid specified flags: -no-network-probe cannot be used with -controller or -trace-probe, they probe the network\n")
+		os.Exit(1)
+	}
+
+	if *readBannerBytes < 0 || *readBannerBytes > maxBannerBytes {
+		fmt.Printf("Invalid specified banner size: %d, it must be between 0 and %d\n", *readBannerBytes, maxBannerBytes)
+		os.Exit(1)
+	}
+
+	if *unhealthyFailureRatio < 0 || *unhealthyFailureRatio >= 1 {
+		fmt.Printf("Invalid specified unhealthy failure ratio: %v, it must be at least 0 and less than 1\n", *unhealthyFailureRatio)
+		os.Exit(1)
+	}
+
+	curves, err := parseCurves(*allowedCurves)
+	if err != nil {
+		fmt.Printf("Invalid specified allowed curves: %v\n", err)
+		os.Exit(1)
+	}
+
+	if _, ok := ipFamilyNetworks[*ipFamily]; !ok && *ipFamily != "both" {
+		fmt.Printf("Invalid specified IP family: %s, it must be auto, ipv4, ipv6 or both\n", *ipFamily)
+		os.Exit(1)
+	}
+
+	if *listPageSize < 0 {
+		fmt.Printf("Invalid specified list page size: %d, it cannot be negative\n", *listPageSize)
+		os.Exit(1)
+	}
+
+	if *historySize < 0 || *historySize > maxHistorySize {
+		fmt.Printf("Invalid specified history size: %d, it must be between 0 and %d\n", *historySize, maxHistorySize)
+		os.Exit(1)
+	}
+	setHistorySize(*historySize)
+
+	var maintenance *maintenanceWindows
+	if *maintenanceWindow != "" {
+		location, err := time.LoadLocation(*maintenanceTimezone)
+		if err != nil {
+			fmt.Printf("Invalid specified maintenance time zone: %v\n", err)
+			os.Exit(1)
+		}
+		maintenance, err = parseMaintenanceWindows(*maintenanceWindow, location)
+		if err != nil {
+			fmt.Printf("Invalid specified maintenance window: %v\n", err)
+			os.Exit(1)
+		}
+	}
+
+	var matchAnnotationKey, matchAnnotationValue string
+	if *matchAnnotation != "" {
+		parts := strings.SplitN(*matchAnnotation, "=", 2)
+		if len(parts) != 2 || parts[0] == "" {
+			fmt.Printf("Invalid specified annotation to match: %s, it must be key=value\n", *matchAnnotation)
+			os.Exit(1)
+		}
+		matchAnnotationKey, matchAnnotationValue = parts[0], parts[1]
+	}
+
+	handshakeSLODuration, err := time.ParseDuration(*handshakeSLO)
+	if err != nil || handshakeSLODuration < 0 {
+		fmt.Printf("Invalid specified handshake SLO: %s\n", *handshakeSLO)
+		os.Exit(1)
+	}
+
+	newTargetGraceDuration, err := time.ParseDuration(*newTargetGrace)
+	if err != nil || newTargetGraceDuration < 0 {
+		fmt.Printf("Invalid specified new target grace: %s\n", *newTargetGrace)
+		os.Exit(1)
+	}
+
+	if *maxDNSConcurrency < 0 {
+		fmt.Printf("Invalid specified DNS concurrency: %d, it cannot be negative\n", *maxDNSConcurrency)
+		os.Exit(1)
+	}
+	setMaxDNSConcurrency(*maxDNSConcurrency)
+
+	if *renewalWindow < 2 {
+		fmt.Printf("Invalid specified renewal window: %d, it must be at least 2\n", *renewalWindow)
+		os.Exit(1)
+	}
+
+	if *burstHandshakes < 0 || *burstHandshakes > maxBurstHandshakes {
+		fmt.Printf("Invalid specified number of burst handshakes: %d, it must be between 0 and %d\n", *burstHandshakes, maxBurstHandshakes)
+		os.Exit(1)
+	}
+
+	if *probePath != "internal" && *probePath != "external" && *probePath != "both" {
+		fmt.Printf("Invalid specified probe path: %s, it must be internal, external or both\n", *probePath)
+		os.Exit(1)
+	}
+
+	if *chainConsistencyWindow < 1 {
+		fmt.Printf("Invalid specified chain consistency window: %d, it must be at least 1\n", *chainConsistencyWindow)
+		os.Exit(1)
+	}
+
+	var roots *x509.CertPool
+	if *caBundle != "" {
+		roots, err = loadCABundle(*caBundle)
+		if err != nil {
+			fmt.Printf("Invalid specified CA bundle: %v\n", err)
+			os.Exit(1)
+		}
+	}
+
+	config := &Config{}
+	if *configFile != "" {
+		config, err = loadConfig(*configFile)
+		if err != nil {
+			fmt.Printf("Invalid specified config file: %v\n", err)
+			os.Exit(1)
+		}
+	}
+
+	var peer *kubernetes.Clientset
+	if *peerAPIServer != "" || *peerKubeconfig != "" {
+		if *noNetworkProbe {
+			fmt.Printf("Invalid specified flags: a peer cluster cannot be compared with -no-network-probe, the peer cluster is probed through the network\n")
+			os.Exit(1)
+		}
+		if *peerKubeconfig != "" && (*peerTokenFile != "" || *peerCAFile != "") {
+			fmt.Printf("Invalid specified flags: -peer-token-file and -peer-ca-file cannot be used with -peer-kubeconfig, which has its own credentials\n")
+			os.Exit(1)
+		}
+		peer, err = newPeerClientset(*peerAPIServer, *peerKubeconfig, *peerTokenFile, *peerCAFile)
+		if err != nil {
+			fmt.Printf("Invalid specified peer cluster: %v\n", err)
+			os.Exit(1)
+		}
+	}
+
+	trust, err := newTrustStore(config, roots)
+	if err != nil {
+		fmt.Printf("Invalid CA bundle in the config file: %v\n", err)
+		os.Exit(1)
+	}
+
+	probe := probeOptions{
+		timeout:           tlsTimeoutDuration,
+		verifyChain:       *verifyChain,
+		roots:             roots,
+		resolveAll:        *resolveAll,
+		estimateClockSkew: *estimateClockSkew,
+		bannerBytes:       *readBannerBytes,
+		ipFamily:          *ipFamily,
+	}
+
+	var extraLabels []string
+	if *ownerLabelKey != "" {
+		extraLabels = append(extraLabels, "owner")
+	}
+	if *resolveAll {
+		extraLabels = append(extraLabels, "address")
+	}
+	if *ipFamily == "both" {
+		extraLabels = append(extraLabels, "ip_family")
+	}
+	if *targetsFilePath != "" || *scanSecrets {
+		extraLabels = append(extraLabels, "source")
+	}
+	if *probePath != "internal" {
+		extraLabels = append(extraLabels, "path")
+	}
+	labelKeys, err := parseTargetLabelKeys(*targetLabelKeys)
+	if err != nil {
+		fmt.Printf("Invalid specified target label keys: %v\n", err)
+		os.Exit(1)
+	}
+	extraLabels = append(extraLabels, labelKeys...)
+	if err := registerTargetMetrics(prometheus.DefaultRegisterer, extraLabels); err != nil {
+		fmt.Printf("Could not register the per-target metrics: %v\n", err)
+		os.Exit(1)
+	}
 
-	healthcheckHandler := func(w http.ResponseWriter, r *http.Request) {
-		fmt.Fprintf(w, "Mi sento bene!")
+	if *traceProbe != "" {
+		os.Exit(traceTarget(os.Stdout, probe, *traceProbe))
 	}
 
-	listenAddr := fmt.Sprintf(":%d", *port)
-	log.Infof("Listening for metrics and healthchecks on %s", listenAddr)
+	var targets *targetsFile
+	if *targetsFilePath != "" {
+		targets, err = watchTargetsFile(*targetsFilePath, 10*time.Second, labelKeys)
+		if err != nil {
+			fmt.Printf("Invalid specified targets file: %v\n", err)
+			os.Exit(1)
+		}
+	}
 
-	http.Handle("/metrics", promhttp.Handler())
-	http.HandleFunc("/livez", healthcheckHandler) /* useful for k8s healthchecks */
-	http.HandleFunc("/healthz", healthcheckHandler)
-	http.ListenAndServe(listenAddr, nil)
+	scan := scanOptions{
+		frequency:                  discoverFrequencyDuration,
+		jitter:                     jitterDuration,
+		immediateFirstScan:         *immediateFirstScan,
+		skipNamespaceRegex:         *skipNamespaceRegex,
+		fieldSelector:              *fieldSelector,
+		listPerNamespace:           *listPerNamespace,
+		listPageSize:               *listPageSize,
+		discoveryConcurrency:       *discoveryConcurrency,
+		kubeQPS:                    float32(*kubeQPS),
+		kubeBurst:                  *kubeBurst,
+		chainConsistencyWindow:     *chainConsistencyWindow,
+		newTargetGrace:             newTargetGraceDuration,
+		handshakeSLO:               handshakeSLODuration,
+		keyIDMetric:                *keyIDMetric,
+		maintenance:                maintenance,
+		matchAnnotationKey:         matchAnnotationKey,
+		matchAnnotationValue:       matchAnnotationValue,
+		renewalWindow:              *renewalWindow,
+		ownerLabelKey:              *ownerLabelKey,
+		requireTargets:             *requireTargets,
+		scanTimeout:                scanTimeoutDuration,
+		adaptiveTimeout:            *adaptiveTimeout,
+		maxSeries:                  *maxSeries,
+		reportIncludePEM:           *reportIncludePEM,
+		probeEndpoints:             *probeEndpoints,
+		probePath:                  *probePath,
+		probeCacheTTL:              probeCacheTTLDuration,
+		trust:                      trust,
+		config:                     config,
+		targetsFile:                targets,
+		annotateServices:           *annotateServices,
+		annotateMinInterval:        annotateMinIntervalDuration,
+		metricsRebuildInterval:     metricsRebuildIntervalDuration,
+		expiryDaysMetric:           *expiryDaysMetric,
+		expiryThreshold:            expiryThresholdDuration,
+		expiryWarningsTop:          *expiryWarningsTop,
+		burstHandshakes:            *burstHandshakes,
+		scanSecrets:                *scanSecrets,
+		compareSecrets:             *compareSecrets,
+		peer:                       peer,
+		unhealthyFailureRatio:      *unhealthyFailureRatio,
+		ignoreIssuers:              parseIssuers(*ignoreIssuers),
+		allowedCurves:              curves,
+		probeTerminatingNamespaces: *probeTerminatingNamespaces,
+		noNetworkProbe:             *noNetworkProbe,
+		once:                       *once,
+		probe:                      probe,
+	}
+
+	modes := runModes{
+		once:           *once,
+		failOn:         *failOn,
+		requireTargets: *requireTargets,
+		scan:           func() scanSummary { return discoverServices(scan) },
+		serve: func() error {
+			return serve(serveOptions{
+				port:              *port,
+				metricsPath:       *metricsPath,
+				livezPath:         *livezPath,
+				healthzPath:       *healthzPath,
+				prometheusMetrics: *prometheusMetrics,
+			})
+		},
+	}
+	if *otlpMetricsEndpoint != "" {
+		modes.pushOTLP = newOTLPExporter(*otlpMetricsEndpoint, otlpPushIntervalDuration, prometheus.DefaultGatherer).run
+	}
+	if *controller {
+		modes.reconcile = func() { runController(probe, discoverFrequencyDuration) }
+	}
+	os.Exit(run(os.Stdout, modes))
 }
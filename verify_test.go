@@ -0,0 +1,121 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// labelNamesOf returns the label names of the metric family as gathered from the registry
+func labelNamesOf(t *testing.T, registry *prometheus.Registry, name string) []string {
+	t.Helper()
+
+	families, err := registry.Gather()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, family := range families {
+		if family.GetName() != name {
+			continue
+		}
+		var names []string
+		for _, label := range family.GetMetric()[0].GetLabel() {
+			names = append(names, label.GetName())
+		}
+		return names
+	}
+	t.Fatalf("%s not found in the registry", name)
+	return nil
+}
+
+func TestRegisterTargetMetricsInSeparateRegistries(t *testing.T) {
+	defer func() { extraTargetLabels = nil }()
+
+	first, second := prometheus.NewRegistry(), prometheus.NewRegistry()
+
+	if err := registerTargetMetrics(first, []string{"owner"}); err != nil {
+		t.Fatalf("registering in the first registry failed: %v", err)
+	}
+	chainValidGauge.WithLabelValues("ns", "svc", "443", "team-a").Set(1)
+
+	if err := registerTargetMetrics(second, []string{"path"}); err != nil {
+		t.Fatalf("registering in the second registry failed: %v", err)
+	}
+	chainValidGauge.WithLabelValues("ns", "svc", "443", "internal").Set(1)
+
+	if names := labelNamesOf(t, first, "tls_verifier_chain_valid"); !reflect.DeepEqual(names, []string{"namespace", "owner", "port", "service"}) {
+		t.Errorf("labels in the first registry: %v", names)
+	}
+	if names := labelNamesOf(t, second, "tls_verifier_chain_valid"); !reflect.DeepEqual(names, []string{"namespace", "path", "port", "service"}) {
+		t.Errorf("labels in the second registry: %v", names)
+	}
+}
+
+func TestRegisterTargetMetricsAgain(t *testing.T) {
+	defer func() { extraTargetLabels = nil }()
+
+	registry := prometheus.NewRegistry()
+	if err := registerTargetMetrics(registry, nil); err != nil {
+		t.Fatal(err)
+	}
+	registered := chainValidGauge
+
+	if err := registerTargetMetrics(registry, nil); err != nil {
+		t.Fatalf("registering the same metrics again failed: %v", err)
+	}
+	if chainValidGauge != registered {
+		t.Errorf("registering the same metrics again did not reuse the registered ones")
+	}
+
+	if err := registerTargetMetrics(registry, []string{"owner"}); err == nil {
+		t.Errorf("registering the metrics with other labels in the same registry did not fail")
+	}
+}
+
+func TestHashedTargetIDOnEveryTargetMetric(t *testing.T) {
+	hashedTargetID = true
+	defer func() { hashedTargetID, extraTargetLabels = false, nil }()
+
+	registry := prometheus.NewRegistry()
+	if err := registerTargetMetrics(registry, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	probeFailuresCounter.WithLabelValues(identityLabelValues("default", "api", "443", "timeout")...).Inc()
+	certRotationsCounter.WithLabelValues(identityLabelValues("default", "api", "443")...).Inc()
+	probeFlapsCounter.WithLabelValues(identityLabelValues("default", "api", "443")...).Inc()
+	soonestExpiryInfo.WithLabelValues(identityLabelValues("default", "api", "443", "1", "ab")...).Set(1)
+	tlsPortRatioGauge.WithLabelValues(identityLabelValues("default", "api")...).Set(1)
+
+	families, err := registry.Gather()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, family := range families {
+		for _, label := range family.GetMetric()[0].GetLabel() {
+			if label.GetName() == "namespace" || label.GetName() == "service" {
+				t.Errorf("%s has the label %s with -hashed-target-id", family.GetName(), label.GetName())
+			}
+			if label.GetName() == "target_id" && label.GetValue() != targetID("default", "api") {
+				t.Errorf("%s has the target id %s, expected %s", family.GetName(), label.GetValue(), targetID("default", "api"))
+			}
+		}
+	}
+}
+
+func TestOwnerOnProbeFailures(t *testing.T) {
+	defer func() { extraTargetLabels = nil }()
+
+	registry := prometheus.NewRegistry()
+	if err := registerTargetMetrics(registry, []string{"owner", "path"}); err != nil {
+		t.Fatal(err)
+	}
+
+	target := scanTarget{namespace: "default", service: "api", port: 443, labels: map[string]string{"owner": "team-a", "path": "internal"}}
+	probeFailuresCounter.WithLabelValues(target.failureLabelValues("default", "api", 443, "timeout")...).Inc()
+
+	if names := labelNamesOf(t, registry, "tls_verifier_probe_failures_total"); !reflect.DeepEqual(names, []string{"namespace", "owner", "port", "reason", "service"}) {
+		t.Errorf("labels of the failures counter: %v", names)
+	}
+}
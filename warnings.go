@@ -0,0 +1,50 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+type expiringCert struct {
+	target     string
+	commonName string
+	notAfter   time.Time
+}
+
+// expiryWarnings collects the certificates expiring soon during a scan, to log them
+// in a single entry instead of one line each
+type expiryWarnings struct {
+	certs []expiringCert
+}
+
+func (w *expiryWarnings) add(target string, commonName string, notAfter time.Time) {
+	w.certs = append(w.certs, expiringCert{target: target, commonName: commonName, notAfter: notAfter})
+}
+
+// log writes the summary of the scan: how many certificates expire soon and the top soonest ones
+func (w *expiryWarnings) log(threshold time.Duration, top int) {
+	if len(w.certs) == 0 {
+		return
+	}
+
+	sort.Slice(w.certs, func(i, j int) bool {
+		if !w.certs[i].notAfter.Equal(w.certs[j].notAfter) {
+			return w.certs[i].notAfter.Before(w.certs[j].notAfter)
+		}
+		return w.certs[i].target < w.certs[j].target
+	})
+
+	soonest := make([]string, 0, top)
+	for i := 0; i < len(w.certs) && i < top; i++ {
+		c := w.certs[i]
+		soonest = append(soonest, fmt.Sprintf("%s (%q) on %s", c.target, c.commonName, c.notAfter.Format("2006-January-02")))
+	}
+
+	log.WithFields(log.Fields{
+		"expiring": len(w.certs),
+		"soonest":  soonest,
+	}).Warnf("%d certificates expire within %v", len(w.certs), threshold)
+}